@@ -0,0 +1,77 @@
+package m65go2
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const (
+	allSuiteAPath   = "test-roms/AllSuiteA/AllSuiteA.bin"
+	allSuiteAOrigin = 0x4000
+	allSuiteAResult = 0x0210
+	allSuiteALimit  = 10000000
+)
+
+// Runs the CPU until it traps, i.e. until an instruction leaves PC
+// unchanged (as a 'JMP *' does), or until 'limit' instructions have
+// been executed.  Returns true iff the CPU trapped.
+func runUntilTrap(cpu *M6502, limit int) (trapped bool, err error) {
+	for i := 0; i < limit; i++ {
+		pc := cpu.Registers.PC
+
+		if _, err = cpu.Execute(); err != nil {
+			return
+		}
+
+		if cpu.Registers.PC == pc {
+			trapped = true
+			return
+		}
+	}
+
+	return
+}
+
+// Runs the AllSuiteA test ROM, which exercises nearly every
+// instruction and stores 0xff at 0x0210 once every test has passed.
+// The ROM is not distributed with this package, place it at
+// test-roms/AllSuiteA/AllSuiteA.bin to enable this test.
+func TestAllSuiteA(t *testing.T) {
+	if _, err := os.Stat(allSuiteAPath); os.IsNotExist(err) {
+		t.Skip("AllSuiteA ROM not found at " + allSuiteAPath)
+	}
+
+	rom, err := ioutil.ReadFile(allSuiteAPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Setup()
+
+	cpu.breakError = false
+
+	for i, b := range rom {
+		cpu.Memory.Store(uint16(allSuiteAOrigin+i), b)
+	}
+
+	cpu.Registers.PC = allSuiteAOrigin
+
+	trapped, err := runUntilTrap(cpu, allSuiteALimit)
+
+	if err != nil {
+		t.Errorf("Error during Run: %s\n", err)
+	}
+
+	if !trapped {
+		t.Errorf("CPU did not trap within %d instructions\n", allSuiteALimit)
+	}
+
+	if result := cpu.Memory.Fetch(allSuiteAResult); result != 0xff {
+		t.Errorf("Memory 0x%04x is %#02x, not 0xff (trapped at 0x%04x)\n",
+			allSuiteAResult, result, cpu.Registers.PC)
+	}
+
+	Teardown()
+}
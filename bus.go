@@ -0,0 +1,130 @@
+package m65go2
+
+import "fmt"
+
+// Represents a device mapped into a range of a Bus's address space.
+type busDevice struct {
+	start  uint16
+	end    uint16
+	device Memory
+}
+
+// Describes the addresses claimed by two devices on a Bus.  Devices
+// added to a Bus earlier take priority, so the Owner receives all
+// accesses between Start and End and the Device is never accessed at
+// those addresses.
+type BusConflict struct {
+	Start  uint16 // first overlapping address
+	End    uint16 // last overlapping address
+	Owner  Memory // the device which was added first
+	Device Memory // the device which is shadowed
+}
+
+func (c BusConflict) Error() string {
+	return fmt.Sprintf("Device conflicts with an earlier device at $%04X-$%04X", c.Start, c.End)
+}
+
+// Represents the CPU's address bus as a set of devices each mapped
+// into a range of addresses.  Devices are passed the full 16-bit
+// address of each access.  Reads from an address which no device
+// claims return 0xff and writes to one are ignored.
+type Bus struct {
+	devices   []busDevice
+	conflicts []BusConflict
+}
+
+// Returns a pointer to a new Bus with no devices.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Maps 'device' into the addresses between 'start' and 'end'
+// inclusive.  If the range overlaps a device added earlier, the
+// earlier device keeps the overlapping addresses, the conflict is
+// recorded and the first such conflict is returned as an error.
+func (bus *Bus) AddDevice(start, end uint16, device Memory) (err error) {
+	if end < start {
+		start, end = end, start
+	}
+
+	for _, d := range bus.devices {
+		if start > d.end || end < d.start {
+			continue
+		}
+
+		conflict := BusConflict{
+			Start:  maxUint16(start, d.start),
+			End:    minUint16(end, d.end),
+			Owner:  d.device,
+			Device: device,
+		}
+
+		bus.conflicts = append(bus.conflicts, conflict)
+
+		if err == nil {
+			err = conflict
+		}
+	}
+
+	bus.devices = append(bus.devices, busDevice{start: start, end: end, device: device})
+
+	return
+}
+
+// Returns every conflict recorded by AddDevice, in the order they
+// were found.
+func (bus *Bus) Conflicts() []BusConflict {
+	return append([]BusConflict(nil), bus.conflicts...)
+}
+
+func (bus *Bus) lookup(address uint16) Memory {
+	for _, d := range bus.devices {
+		if address >= d.start && address <= d.end {
+			return d.device
+		}
+	}
+
+	return nil
+}
+
+// Resets every device on the bus
+func (bus *Bus) Reset() {
+	for _, d := range bus.devices {
+		d.device.Reset()
+	}
+}
+
+// Returns the value stored at the given address by the device which
+// claims it
+func (bus *Bus) Fetch(address uint16) (value uint8) {
+	if device := bus.lookup(address); device != nil {
+		return device.Fetch(address)
+	}
+
+	return 0xff
+}
+
+// Stores the value at the given address in the device which claims it
+func (bus *Bus) Store(address uint16, value uint8) (oldValue uint8) {
+	if device := bus.lookup(address); device != nil {
+		return device.Store(address, value)
+	}
+
+	return
+}
+
+func minUint16(a, b uint16) uint16 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxUint16(a, b uint16) uint16 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,46 @@
+package m65go2
+
+import "testing"
+
+func TestBusConflicts(t *testing.T) {
+	bus := NewBus()
+	ram := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+	rom := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	if err := bus.AddDevice(0x0000, 0x1fff, ram); err != nil {
+		t.Errorf("Error adding the first device: %s\n", err)
+	}
+
+	err := bus.AddDevice(0x1800, 0x3fff, rom)
+
+	if c, ok := err.(BusConflict); !ok {
+		t.Error("Did not receive expected error type BusConflict")
+	} else if c.Start != 0x1800 || c.End != 0x1fff {
+		t.Errorf("Conflict is $%04X-$%04X, not $1800-$1FFF\n", c.Start, c.End)
+	}
+
+	conflicts := bus.Conflicts()
+
+	if len(conflicts) != 1 {
+		t.Fatalf("%d conflicts reported, not 1\n", len(conflicts))
+	}
+
+	if conflicts[0].Owner != Memory(ram) || conflicts[0].Device != Memory(rom) {
+		t.Error("Conflict does not report ram as owner of rom's addresses")
+	}
+
+	bus.Store(0x1800, 0x42)
+	bus.Store(0x2000, 0x43)
+
+	if ram.Fetch(0x1800) != 0x42 || rom.Fetch(0x1800) != 0x00 {
+		t.Error("Write to 0x1800 did not go to the earlier device")
+	}
+
+	if rom.Fetch(0x2000) != 0x43 {
+		t.Error("Write to 0x2000 did not go to the later device")
+	}
+
+	if bus.Fetch(0x8000) != 0xff {
+		t.Error("Read from an unmapped address is not 0xff")
+	}
+}
@@ -2,6 +2,7 @@ package m65go2
 
 import (
 	_ "fmt"
+	"math"
 	"sync"
 	"time"
 )
@@ -34,7 +35,7 @@ type Clock struct {
 	ticks    uint64
 	ticker   *time.Ticker
 	stopChan chan int
-	mutex    sync.Mutex
+	mutex    sync.Mutex // guards ticks, ticker, stopChan and waiting
 	waiting  map[uint64][]chan int
 }
 
@@ -46,7 +47,7 @@ func NewClock(rate time.Duration) *Clock {
 		rate:     rate,
 		ticks:    0,
 		ticker:   nil,
-		stopChan: make(chan int),
+		stopChan: nil,
 		waiting:  make(map[uint64][]chan int),
 	}
 }
@@ -61,14 +62,13 @@ func (clock *Clock) wakeWaiting() {
 	}
 }
 
-func (clock *Clock) maintainTime() {
+func (clock *Clock) maintainTime(ticker *time.Ticker, stop chan int) {
 	for {
 		select {
-		case <-clock.stopChan:
-			clock.ticker.Stop()
-			clock.ticker = nil
+		case <-stop:
+			ticker.Stop()
 			return
-		case _ = <-clock.ticker.C:
+		case _ = <-ticker.C:
 			clock.mutex.Lock()
 			clock.ticks++
 			clock.wakeWaiting()
@@ -86,22 +86,72 @@ func (clock *Clock) Ticks() (ticks uint64) {
 }
 
 func (clock *Clock) Start() (ticks uint64) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
 	ticks = clock.ticks
 
 	if clock.ticker == nil {
 		clock.ticker = time.NewTicker(clock.rate)
-		go clock.maintainTime()
+		clock.stopChan = make(chan int)
+		go clock.maintainTime(clock.ticker, clock.stopChan)
 	}
 
 	return
 }
 
-func (clock *Clock) Stop() {
+// Changes the interval at which the clock ticks to 'rate'.  If the
+// clock is running, the next tick arrives 'rate' after the call.  The
+// ticks counter is preserved.
+func (clock *Clock) SetRate(rate time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	clock.rate = rate
+
 	if clock.ticker != nil {
-		clock.stopChan <- 1
+		clock.ticker.Reset(rate)
+	}
+}
+
+// Stops the clock and returns once it will no longer tick.  Each
+// start of the clock has its own stop channel, so stopping can never
+// be mistaken for a later start.  Stop may be called any number of
+// times, concurrently, and before the clock has been started.
+func (clock *Clock) Stop() {
+	clock.mutex.Lock()
+	stop := clock.stopChan
+	clock.ticker, clock.stopChan = nil, nil
+	clock.mutex.Unlock()
+
+	if stop != nil {
+		stop <- 1
 	}
 }
 
+// Stops the clock if it is running and zeroes its ticks counter.  Any
+// callers blocked in Await are woken and return the zeroed count, so
+// they do not wait forever for a tick which will now arrive much
+// later.  The Clock keeps its identity, so Dividers referencing it
+// remain valid.
+func (clock *Clock) Reset() {
+	clock.Stop()
+
+	clock.mutex.Lock()
+
+	clock.ticks = 0
+
+	for tick, Ca := range clock.waiting {
+		for _, C := range Ca {
+			C <- 1
+		}
+
+		delete(clock.waiting, tick)
+	}
+
+	clock.mutex.Unlock()
+}
+
 func (clock *Clock) Increment(amount uint64) (ticks uint64) {
 	clock.mutex.Lock()
 
@@ -128,6 +178,7 @@ func (clock *Clock) Await(tick uint64) (ticks uint64) {
 		clock.waiting[tick] = append(clock.waiting[tick], C)
 		clock.mutex.Unlock()
 		<-C
+		ticks = clock.Ticks()
 	}
 
 	return
@@ -138,6 +189,7 @@ func (clock *Clock) Await(tick uint64) (ticks uint64) {
 type Divider struct {
 	master  Clocker
 	divisor uint64
+	offset  uint64
 }
 
 // Returns a pointer to a new DividerCLock which divides the tick rate
@@ -146,23 +198,211 @@ func NewDivider(master Clocker, divisor uint64) *Divider {
 	return &Divider{divisor: divisor, master: master}
 }
 
+// Returns a pointer to a new Divider which divides the tick rate of
+// 'master' by 'divisor', with its ticks leading the master's by
+// 'offset' master ticks.  This aligns a divided clock with one which
+// started partway through a divided tick.
+func NewDividerWithOffset(master Clocker, divisor uint64, offset uint64) *Divider {
+	return &Divider{divisor: divisor, master: master, offset: offset}
+}
+
+// Returns the master Clocker's ticks plus the offset, divided by the
+// divisor.  The divided count is derived from the master every time
+// it is read, so it is always consistent with the master regardless
+// of whether the master has been started.
 func (clock *Divider) Ticks() uint64 {
-	return clock.master.Ticks() / clock.divisor
+	return clock.divide(clock.master.Ticks())
+}
+
+func (clock *Divider) divide(master uint64) uint64 {
+	return (master + clock.offset) / clock.divisor
 }
 
+// Starts the master Clocker if it has not already been started and
+// returns the divided ticks.
 func (clock *Divider) Start() (ticks uint64) {
-	return clock.master.Start() / clock.divisor
+	return clock.divide(clock.master.Start())
 }
 
 func (clock *Divider) Stop() {
 	clock.master.Stop()
 }
 
+// Blocks until the divided ticks reach 'tick'.  Divided tick N spans
+// the master ticks N*divisor-offset to (N+1)*divisor-offset-1, so
+// Await waits until the master reaches tick*divisor-offset, the first
+// master tick at which Ticks returns 'tick'.  Returns the divided
+// ticks at that point, which are at least 'tick'.
 func (clock *Divider) Await(tick uint64) (ticks uint64) {
-	return clock.master.Await(tick*clock.divisor) / clock.divisor
+	master := uint64(math.MaxUint64)
+
+	if tick <= master/clock.divisor {
+		master = tick * clock.divisor
+	}
+
+	if master > clock.offset {
+		master -= clock.offset
+	} else {
+		master = 0
+	}
+
+	return clock.divide(clock.master.Await(master))
 }
 
 func (clock *Divider) Increment(amount uint64) (ticks uint64) {
-	ticks = clock.master.Increment(amount * clock.divisor)
+	return clock.divide(clock.master.Increment(amount * clock.divisor))
+}
+
+// Represents a clock multiplier which multiplies the tick frequency
+// of another Clock so that it ticks at a faster rate.  It ticks
+// 'factor' times at once for every tick of the master.
+type Multiplier struct {
+	master Clocker
+	factor uint64
+}
+
+// Returns a pointer to a new Multiplier which multiplies the tick
+// rate of 'master' Clocker by 'factor'.
+func NewMultiplier(master Clocker, factor uint64) *Multiplier {
+	return &Multiplier{master: master, factor: factor}
+}
+
+// Returns the master Clocker's ticks multiplied by the factor.
+func (clock *Multiplier) Ticks() uint64 {
+	return clock.master.Ticks() * clock.factor
+}
+
+// Starts the master Clocker if it has not already been started and
+// returns the multiplied ticks.
+func (clock *Multiplier) Start() (ticks uint64) {
+	return clock.master.Start() * clock.factor
+}
+
+func (clock *Multiplier) Stop() {
+	clock.master.Stop()
+}
+
+// Blocks until the multiplied ticks reach 'tick', which happens once
+// the master reaches 'tick' divided by the factor, rounded up.
+// Returns the multiplied ticks at that point, which are at least
+// 'tick'.
+func (clock *Multiplier) Await(tick uint64) (ticks uint64) {
+	return clock.master.Await(clock.masterTicks(tick)) * clock.factor
+}
+
+// Increments the master Clocker's ticks by 'amount' divided by the
+// factor, rounded up, since the multiplied ticks can only advance in
+// steps of the factor.
+func (clock *Multiplier) Increment(amount uint64) (ticks uint64) {
+	return clock.master.Increment(clock.masterTicks(amount)) * clock.factor
+}
+
+func (clock *Multiplier) masterTicks(ticks uint64) uint64 {
+	return ticks/clock.factor + (ticks%clock.factor+clock.factor-1)/clock.factor
+}
+
+// Represents a clock whose ticks are advanced by the host rather than
+// by a timer, for integrating with a host which already has its own
+// master timing such as an audio callback.
+type ExternalClock struct {
+	ticks       uint64
+	nonBlocking bool
+	mutex       sync.Mutex
+	cond        *sync.Cond
+}
+
+// Returns a pointer to a new ExternalClock whose ticks counter is
+// zero.  Await blocks until the host has advanced the clock far
+// enough.
+func NewExternalClock() *ExternalClock {
+	clock := &ExternalClock{}
+	clock.cond = sync.NewCond(&clock.mutex)
+	return clock
+}
+
+// Causes Await to return immediately rather than blocking until the
+// given tick has arrived.
+func (clock *ExternalClock) DisableBlocking() {
+	clock.mutex.Lock()
+	clock.nonBlocking = true
+	clock.mutex.Unlock()
+
+	clock.cond.Broadcast()
+}
+
+// Causes Await to block again after a call to DisableBlocking.
+func (clock *ExternalClock) EnableBlocking() {
+	clock.mutex.Lock()
+	clock.nonBlocking = false
+	clock.mutex.Unlock()
+}
+
+// Advances the ticks counter by 'n', waking any callers of Await
+// waiting for a tick which has now arrived.
+func (clock *ExternalClock) Advance(n uint64) (ticks uint64) {
+	clock.mutex.Lock()
+	clock.ticks += n
+	ticks = clock.ticks
+	clock.mutex.Unlock()
+
+	clock.cond.Broadcast()
+
 	return
 }
+
+func (clock *ExternalClock) Ticks() (ticks uint64) {
+	clock.mutex.Lock()
+	ticks = clock.ticks
+	clock.mutex.Unlock()
+
+	return
+}
+
+// Returns the current ticks.  The host drives the clock, so there is
+// nothing to start.
+func (clock *ExternalClock) Start() (ticks uint64) {
+	return clock.Ticks()
+}
+
+// Does nothing, the host drives the clock.
+func (clock *ExternalClock) Stop() {
+}
+
+// Blocks until the host has advanced the clock to at least 'tick',
+// unless blocking has been disabled.
+func (clock *ExternalClock) Await(tick uint64) (ticks uint64) {
+	clock.mutex.Lock()
+
+	for clock.ticks < tick && !clock.nonBlocking {
+		clock.cond.Wait()
+	}
+
+	ticks = clock.ticks
+
+	clock.mutex.Unlock()
+
+	return
+}
+
+// Advances the ticks counter by 'amount', exactly as Advance does.
+func (clock *ExternalClock) Increment(amount uint64) (ticks uint64) {
+	return clock.Advance(amount)
+}
+
+// Represents a clock for deterministic tests, whose ticks only
+// advance when the test calls Tick or Advance.  It behaves exactly as
+// an ExternalClock does.
+type ManualClock struct {
+	*ExternalClock
+}
+
+// Returns a pointer to a new ManualClock whose ticks counter is zero.
+func NewManualClock() *ManualClock {
+	return &ManualClock{NewExternalClock()}
+}
+
+// Advances the ticks counter by one, waking any callers of Await
+// waiting for the new tick.
+func (clock *ManualClock) Tick() (ticks uint64) {
+	return clock.Advance(1)
+}
@@ -0,0 +1,481 @@
+package m65go2
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDividerTicks(t *testing.T) {
+	master := NewClock(time.Hour)
+	divider := NewDivider(master, 3)
+
+	if divider.Ticks() != 0 {
+		t.Error("Divider ticks is not 0")
+	}
+
+	for _, amount := range []uint64{1, 1, 1, 2, 10} {
+		master.Increment(amount)
+
+		if divider.Ticks() != master.Ticks()/3 {
+			t.Errorf("Divider ticks is %d, not %d\n", divider.Ticks(), master.Ticks()/3)
+		}
+	}
+
+	if divider.Start() != master.Ticks()/3 {
+		t.Error("Divider Start did not return the divided master ticks")
+	}
+
+	if divider.Start() != master.Ticks()/3 {
+		t.Error("Divider Start on a running master did not return the divided master ticks")
+	}
+
+	divider.Stop()
+}
+
+func TestExternalClock(t *testing.T) {
+	clock := NewExternalClock()
+
+	var _ Clocker = clock
+
+	done := make(chan uint64)
+
+	go func() {
+		done <- clock.Await(10)
+	}()
+
+	for i := 0; i < 9; i++ {
+		clock.Advance(1)
+
+		select {
+		case ticks := <-done:
+			t.Fatalf("Await returned at tick %d, before tick 10\n", ticks)
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	clock.Advance(1)
+
+	select {
+	case ticks := <-done:
+		if ticks != 10 {
+			t.Errorf("Await returned %d, not 10\n", ticks)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Await did not return at tick 10")
+	}
+
+	clock.DisableBlocking()
+
+	if ticks := clock.Await(100); ticks != 10 {
+		t.Errorf("Non-blocking Await returned %d, not 10\n", ticks)
+	}
+}
+
+func TestClockConcurrentAwait(t *testing.T) {
+	clock := NewClock(100 * time.Microsecond)
+	clock.Start()
+
+	done := make(chan uint64)
+
+	for i := 0; i < 8; i++ {
+		go func(tick uint64) {
+			done <- clock.Await(tick)
+		}(uint64(5 + i%3))
+	}
+
+	for i := 0; i < 8; i++ {
+		select {
+		case ticks := <-done:
+			if ticks < 5 {
+				t.Errorf("Await returned at tick %d, before tick 5\n", ticks)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Await did not return")
+		}
+	}
+
+	clock.Stop()
+	clock.Start()
+	clock.Stop()
+}
+
+func TestClockReset(t *testing.T) {
+	clock := NewClock(100 * time.Microsecond)
+	divider := NewDivider(clock, 2)
+
+	clock.Start()
+	clock.Await(10)
+
+	done := make(chan uint64)
+
+	go func() {
+		done <- clock.Await(1 << 40)
+	}()
+
+	// wait for the goroutine to block in Await
+	for {
+		clock.mutex.Lock()
+		waiting := len(clock.waiting)
+		clock.mutex.Unlock()
+
+		if waiting != 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Reset()
+
+	select {
+	case ticks := <-done:
+		if ticks != 0 {
+			t.Errorf("Await returned %d, not 0\n", ticks)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Await did not return after Reset")
+	}
+
+	time.Sleep(time.Millisecond)
+
+	if clock.Ticks() != 0 {
+		t.Errorf("Ticks is %d, not 0\n", clock.Ticks())
+	}
+
+	if divider.Ticks() != 0 {
+		t.Errorf("Divider ticks is %d, not 0\n", divider.Ticks())
+	}
+
+	clock.Increment(4)
+
+	if divider.Ticks() != 2 {
+		t.Errorf("Divider ticks is %d, not 2\n", divider.Ticks())
+	}
+}
+
+func TestClockStop(t *testing.T) {
+	done := make(chan bool)
+
+	go func() {
+		clock := NewClock(100 * time.Microsecond)
+
+		// never started
+		clock.Stop()
+		clock.Stop()
+
+		clock.Start()
+		clock.Await(5)
+
+		// twice in a row
+		clock.Stop()
+		clock.Stop()
+
+		ticks := clock.Ticks()
+		time.Sleep(time.Millisecond)
+
+		if clock.Ticks() != ticks {
+			t.Error("Clock ticked after Stop")
+		}
+
+		// concurrently, interleaved with restarts
+		clock.Start()
+
+		stopped := make(chan bool)
+
+		for i := 0; i < 8; i++ {
+			go func() {
+				clock.Stop()
+				clock.Start()
+				clock.Stop()
+				stopped <- true
+			}()
+		}
+
+		for i := 0; i < 8; i++ {
+			<-stopped
+		}
+
+		clock.Stop()
+
+		ticks = clock.Ticks()
+		time.Sleep(time.Millisecond)
+
+		if clock.Ticks() != ticks {
+			t.Error("Clock ticked after concurrent Stop")
+		}
+
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop blocked")
+	}
+}
+
+func TestClockSetRate(t *testing.T) {
+	clock := NewClock(time.Hour)
+
+	clock.Increment(3)
+	clock.Start()
+
+	clock.SetRate(time.Millisecond)
+
+	if clock.Ticks() != 3 {
+		t.Errorf("Ticks is %d, not 3\n", clock.Ticks())
+	}
+
+	start := time.Now()
+	clock.Await(23)
+	elapsed := time.Since(start)
+
+	// 20 ticks at 1ms, with generous tolerance for scheduling
+	if elapsed < 15*time.Millisecond || elapsed > time.Second {
+		t.Errorf("20 ticks took %s, not about 20ms\n", elapsed)
+	}
+
+	clock.SetRate(time.Hour)
+
+	// let any tick already in flight arrive
+	time.Sleep(2 * time.Millisecond)
+
+	ticks := clock.Ticks()
+	time.Sleep(5 * time.Millisecond)
+
+	if clock.Ticks() != ticks {
+		t.Error("Clock ticked after slowing to one tick per hour")
+	}
+
+	clock.Stop()
+	clock.SetRate(time.Millisecond)
+
+	if clock.Ticks() != ticks {
+		t.Error("SetRate started a stopped clock")
+	}
+}
+
+func TestManualClock(t *testing.T) {
+	clock := NewManualClock()
+
+	var _ Clocker = clock
+
+	done := make(chan uint64)
+
+	go func() {
+		done <- clock.Await(5)
+	}()
+
+	for i := 0; i < 2; i++ {
+		clock.Tick()
+	}
+
+	clock.Advance(2)
+
+	select {
+	case ticks := <-done:
+		t.Fatalf("Await returned at tick %d, before tick 5\n", ticks)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if clock.Tick() != 5 {
+		t.Error("Tick did not return 5")
+	}
+
+	select {
+	case ticks := <-done:
+		if ticks != 5 {
+			t.Errorf("Await returned %d, not 5\n", ticks)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Await did not return at tick 5")
+	}
+
+	if clock.Await(3) != 5 {
+		t.Error("Await for a past tick did not return immediately")
+	}
+}
+
+func TestDividerAwait(t *testing.T) {
+	for _, divisor := range []uint64{1, 2, 3, 7, 12} {
+		master := NewManualClock()
+		divider := NewDivider(master, divisor)
+
+		var last uint64
+
+		for tick := uint64(1); tick <= 4; tick++ {
+			done := make(chan uint64)
+
+			go func(tick uint64) {
+				done <- divider.Await(tick)
+			}(tick)
+
+			for master.Ticks() < tick*divisor-1 {
+				master.Tick()
+
+				if divider.Ticks() < last || divider.Ticks() != master.Ticks()/divisor {
+					t.Errorf("Divisor %d: Ticks is %d at master tick %d\n", divisor, divider.Ticks(), master.Ticks())
+				}
+
+				last = divider.Ticks()
+			}
+
+			select {
+			case ticks := <-done:
+				t.Fatalf("Divisor %d: Await(%d) returned %d at master tick %d\n", divisor, tick, ticks, master.Ticks())
+			case <-time.After(time.Millisecond):
+			}
+
+			master.Tick()
+
+			select {
+			case ticks := <-done:
+				if ticks != tick || divider.Ticks() != tick {
+					t.Errorf("Divisor %d: Await(%d) returned %d\n", divisor, tick, ticks)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Divisor %d: Await(%d) did not return at master tick %d\n", divisor, tick, master.Ticks())
+			}
+		}
+	}
+
+	master := NewManualClock()
+	divider := NewDivider(master, 3)
+
+	master.Advance(5)
+
+	done := make(chan uint64)
+
+	// tick*3 wraps around to master tick 2
+	go func() {
+		done <- divider.Await(math.MaxUint64/3 + 1)
+	}()
+
+	select {
+	case <-done:
+		t.Error("Await overflowed its master tick")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	master.DisableBlocking()
+	<-done
+}
+
+func TestDividerWithOffset(t *testing.T) {
+	for _, c := range []struct {
+		divisor, offset uint64
+	}{{4, 0}, {4, 1}, {4, 3}, {4, 4}, {4, 9}, {3, 2}} {
+		master := NewManualClock()
+		divider := NewDividerWithOffset(master, c.divisor, c.offset)
+
+		if divider.Ticks() != c.offset/c.divisor {
+			t.Errorf("Divisor %d offset %d: initial Ticks is %d, not %d\n",
+				c.divisor, c.offset, divider.Ticks(), c.offset/c.divisor)
+		}
+
+		last := divider.Ticks()
+
+		for i := 0; i < 20; i++ {
+			master.Tick()
+
+			ticks := divider.Ticks()
+
+			if ticks < last {
+				t.Errorf("Divisor %d offset %d: Ticks went backwards from %d to %d\n",
+					c.divisor, c.offset, last, ticks)
+			}
+
+			if ticks != (master.Ticks()+c.offset)/c.divisor {
+				t.Errorf("Divisor %d offset %d: Ticks is %d at master tick %d\n",
+					c.divisor, c.offset, ticks, master.Ticks())
+			}
+
+			last = ticks
+		}
+
+		// the master ticks until the next divided tick
+		next := last + 1
+		remaining := next*c.divisor - c.offset - master.Ticks()
+
+		done := make(chan uint64)
+
+		go func() {
+			done <- divider.Await(next)
+		}()
+
+		master.Advance(remaining - 1)
+
+		select {
+		case <-done:
+			t.Fatalf("Divisor %d offset %d: Await returned early\n", c.divisor, c.offset)
+		case <-time.After(time.Millisecond):
+		}
+
+		master.Tick()
+
+		select {
+		case ticks := <-done:
+			if ticks != next {
+				t.Errorf("Divisor %d offset %d: Await returned %d, not %d\n", c.divisor, c.offset, ticks, next)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Divisor %d offset %d: Await did not return\n", c.divisor, c.offset)
+		}
+
+		if divider.Await(0) != next {
+			t.Errorf("Divisor %d offset %d: Await for a past tick did not return immediately\n", c.divisor, c.offset)
+		}
+
+		if ticks := divider.Increment(2); ticks != divider.Ticks() || ticks != next+2 {
+			t.Errorf("Divisor %d offset %d: Increment returned %d, not %d\n", c.divisor, c.offset, ticks, next+2)
+		}
+	}
+}
+
+func TestMultiplier(t *testing.T) {
+	master := NewManualClock()
+	multiplier := NewMultiplier(master, 3)
+
+	var _ Clocker = multiplier
+
+	for i := uint64(0); i < 5; i++ {
+		if multiplier.Ticks() != master.Ticks()*3 {
+			t.Errorf("Multiplier ticks is %d, not %d\n", multiplier.Ticks(), master.Ticks()*3)
+		}
+
+		master.Tick()
+	}
+
+	done := make(chan uint64)
+
+	// 16 multiplied ticks need 6 master ticks
+	go func() {
+		done <- multiplier.Await(16)
+	}()
+
+	select {
+	case ticks := <-done:
+		t.Fatalf("Await returned %d at master tick %d\n", ticks, master.Ticks())
+	case <-time.After(time.Millisecond):
+	}
+
+	master.Tick()
+
+	select {
+	case ticks := <-done:
+		if ticks != 18 {
+			t.Errorf("Await returned %d, not 18\n", ticks)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Await did not return at master tick 6")
+	}
+
+	if multiplier.Await(18) != 18 {
+		t.Error("Await for the current tick did not return immediately")
+	}
+
+	if multiplier.Increment(4) != 24 || master.Ticks() != 8 {
+		t.Error("Increment of 4 did not advance the master by 2")
+	}
+}
@@ -2,8 +2,13 @@
 package m65go2
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Flags used by P (Status) register
@@ -20,6 +25,21 @@ const (
 	N                    // negative flag
 )
 
+// Returns the flags in the order NV-BDIZC, each as an upper case
+// letter if set and a lower case letter if clear.  The unused bit is
+// always shown as '-'.
+func (s Status) String() string {
+	flags := []byte("nv-bdizc")
+
+	for i, flag := range []Status{N, V, U, B, D, I, Z, C} {
+		if flag != U && s&flag != 0 {
+			flags[i] -= 'a' - 'A'
+		}
+	}
+
+	return string(flags)
+}
+
 // The 6502's registers, all registers are 8-bit values except for PC
 // which is 16-bits.
 type Registers struct {
@@ -51,11 +71,140 @@ func (reg *Registers) Reset() {
 	reg.PC = 0xfffc
 }
 
-// Prints the values of each register to os.Stderr.
-func (reg *Registers) String() string {
-	return fmt.Sprintf("A:%02X X:%02X Y:%02X P:%02X SP:%02X", reg.A, reg.X, reg.Y, reg.P, reg.SP)
+// Sets the P register to 'value' the way the 6502 does when
+// restoring it from the stack: the B bit, which only exists in the
+// copies of P pushed to the stack, is ignored and the unused bit 5 is
+// forced to 1.
+func (reg *Registers) SetP(value uint8) {
+	reg.P = (Status(value) &^ B) | U
+}
+
+// Returns the P register as a raw byte.
+func (reg Registers) GetP() uint8 {
+	return uint8(reg.P)
+}
+
+// Encodes the registers as 7 bytes: A, X, Y, P, SP and then PC in
+// little-endian order.  Implements encoding.BinaryMarshaler.
+func (reg Registers) MarshalBinary() (data []byte, err error) {
+	return []byte{reg.A, reg.X, reg.Y, uint8(reg.P), reg.SP, uint8(reg.PC), uint8(reg.PC >> 8)}, nil
+}
+
+// Decodes registers encoded by MarshalBinary.  Implements
+// encoding.BinaryUnmarshaler.
+func (reg *Registers) UnmarshalBinary(data []byte) error {
+	if len(data) != 7 {
+		return fmt.Errorf("Registers: invalid encoding length %d", len(data))
+	}
+
+	reg.A, reg.X, reg.Y = data[0], data[1], data[2]
+	reg.P, reg.SP = Status(data[3]), data[4]
+	reg.PC = uint16(data[5]) | uint16(data[6])<<8
+
+	return nil
+}
+
+// The P register as encoded by Registers.MarshalJSON.
+type jsonFlags struct {
+	N, V, U, B, D, I, Z, C bool
+}
+
+type jsonRegisters struct {
+	A, X, Y string
+	P       jsonFlags
+	SP, PC  string
+}
+
+func newJSONFlags(p Status) jsonFlags {
+	return jsonFlags{
+		N: p&N != 0, V: p&V != 0, U: p&U != 0, B: p&B != 0,
+		D: p&D != 0, I: p&I != 0, Z: p&Z != 0, C: p&C != 0,
+	}
+}
+
+func (flags jsonFlags) status() (p Status) {
+	for flag, set := range map[Status]bool{
+		N: flags.N, V: flags.V, U: flags.U, B: flags.B,
+		D: flags.D, I: flags.I, Z: flags.Z, C: flags.C,
+	} {
+		if set {
+			p |= flag
+		}
+	}
+
+	return
 }
 
+// Encodes the registers as a JSON object, with A, X, Y, SP and PC as
+// hex strings and P as an object with a boolean for each flag, e.g.
+// {"A":"0x00",...,"P":{"N":false,...},"SP":"0xfd","PC":"0xc000"}.
+// Implements json.Marshaler.
+func (reg Registers) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonRegisters{
+		A:  fmt.Sprintf("0x%02x", reg.A),
+		X:  fmt.Sprintf("0x%02x", reg.X),
+		Y:  fmt.Sprintf("0x%02x", reg.Y),
+		P:  newJSONFlags(reg.P),
+		SP: fmt.Sprintf("0x%02x", reg.SP),
+		PC: fmt.Sprintf("0x%04x", reg.PC),
+	})
+}
+
+// Decodes registers encoded by MarshalJSON.  Implements
+// json.Unmarshaler.
+func (reg *Registers) UnmarshalJSON(data []byte) error {
+	var j jsonRegisters
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	r := Registers{P: j.P.status()}
+
+	for _, field := range []struct {
+		value string
+		size  int
+		set   func(value uint64)
+	}{
+		{j.A, 8, func(value uint64) { r.A = uint8(value) }},
+		{j.X, 8, func(value uint64) { r.X = uint8(value) }},
+		{j.Y, 8, func(value uint64) { r.Y = uint8(value) }},
+		{j.SP, 8, func(value uint64) { r.SP = uint8(value) }},
+		{j.PC, 16, func(value uint64) { r.PC = uint16(value) }},
+	} {
+		value, err := strconv.ParseUint(field.value, 0, field.size)
+
+		if err != nil {
+			return fmt.Errorf("Registers: %s", err)
+		}
+
+		field.set(value)
+	}
+
+	*reg = r
+
+	return nil
+}
+
+// Returns the values of each register followed by the flags of the P
+// register, e.g. "A:00 X:00 Y:00 P:24 SP:FD PC:C000 nv-bdIzc".
+func (reg Registers) String() string {
+	return fmt.Sprintf("%s PC:%04X %s", reg.trace(), reg.PC, reg.P)
+}
+
+// Returns the registers in the format used by decode lines.
+func (reg Registers) trace() string {
+	return fmt.Sprintf("A:%02X X:%02X Y:%02X P:%02X SP:%02X", reg.A, reg.X, reg.Y, uint8(reg.P), reg.SP)
+}
+
+// Identifies the member of the 6502 family emulated by an M6502.
+type Variant uint8
+
+const (
+	NMOS6502  Variant = iota // the original NMOS 6502
+	CMOS65C02                // the CMOS 65C02
+)
+
 type Interrupt uint8
 
 const (
@@ -71,8 +220,30 @@ const (
 	Y
 )
 
+// Receives a line of text for each instruction executed while
+// decoding is enabled.  'pc' is the address the instruction was
+// fetched from and 'opcode' is its opcode.
+type Tracer interface {
+	Trace(pc uint16, opcode OpCode, text string)
+}
+
+// A Tracer which writes each line of text to an io.Writer.
+type WriterTracer struct {
+	w io.Writer
+}
+
+// Returns a pointer to a new WriterTracer which writes to 'w'.
+func NewWriterTracer(w io.Writer) *WriterTracer {
+	return &WriterTracer{w: w}
+}
+
+func (tracer *WriterTracer) Trace(pc uint16, opcode OpCode, text string) {
+	fmt.Fprintln(tracer.w, text)
+}
+
 type decode struct {
 	enabled     bool
+	tracer      Tracer
 	pc          uint16
 	opcode      OpCode
 	args        string
@@ -82,6 +253,14 @@ type decode struct {
 	ticks       uint64
 }
 
+func (d *decode) print() {
+	if d.tracer != nil {
+		d.tracer.Trace(d.pc, d.opcode, d.String())
+	} else {
+		fmt.Println(d.String())
+	}
+}
+
 func (d *decode) String() string {
 	return fmt.Sprintf("%04X  %02X %-5s %4s %-26s  %25s",
 		d.pc, d.opcode, d.args, d.mneumonic, d.decodedArgs, d.registers)
@@ -92,17 +271,44 @@ type M6502 struct {
 	decode       decode
 	Nmi          bool
 	Irq          bool
+	irqLine      bool
 	Rst          bool
 	Registers    Registers
 	Memory       Memory
 	Instructions InstructionTable
 	decimalMode  bool
 	breakError   bool
+	noCycles     bool
+	rawUnused    bool
+	branchDelay  bool
+	delayPoll    bool
+	nullTrap     bool
+	strictPC     bool
+	illegalOps   bool
+	fault        error
+	breakCycle   uint64
+	cycles       uint64
+	breakpoints  map[uint16]bool
+	halted       bool
+	jammed       bool
+	variant      Variant
+	haltCycles   uint16
+	keepFlags    bool
+	instPC       uint16
+	instOpCode   OpCode
+	flagChange   func(old, new Status)
+	stackRead    func(pc uint16, address uint16)
+	badVector    func(vector uint16)
+	decimalUse   func(pc uint16)
+	adjustCycles func(cpu *M6502, op OpCode, baseCycles uint16) uint16
+	postExec     func(cpu *M6502, cycles uint16)
 	Cycles       chan uint16
 }
 
-// Returns a pointer to a new CPU with the given Memory.
-func NewM6502(mem Memory) *M6502 {
+// Returns a pointer to a new CPU with the given Memory.  If 'cycles'
+// is non-nil, Run will send the cycles consumed by each instruction
+// on it and wait for a value to be sent back before continuing.
+func NewM6502(mem Memory, cycles chan uint16) *M6502 {
 	instructions := NewInstructionTable()
 	instructions.InitInstructions()
 
@@ -116,17 +322,75 @@ func NewM6502(mem Memory) *M6502 {
 		Nmi:          false,
 		Irq:          false,
 		Rst:          false,
-		Cycles:       make(chan uint16),
+		noCycles:     false,
+		rawUnused:    false,
+		branchDelay:  false,
+		delayPoll:    false,
+		nullTrap:     false,
+		strictPC:     false,
+		illegalOps:   false,
+		fault:        nil,
+		breakCycle:   0,
+		cycles:       0,
+		breakpoints:  make(map[uint16]bool),
+		halted:       false,
+		jammed:       false,
+		variant:      NMOS6502,
+		haltCycles:   1,
+		keepFlags:    false,
+		instPC:       0,
+		instOpCode:   0,
+		stackRead:    nil,
+		badVector:    nil,
+		decimalUse:   nil,
+		adjustCycles: nil,
+		Cycles:       cycles,
 	}
 }
 
+// Returns a pointer to a new CPU emulating the given member of the
+// 6502 family, as if SetVariant had been called on the CPU returned by
+// NewM6502.
+func NewM6502WithVariant(mem Memory, cycles chan uint16, variant Variant) *M6502 {
+	cpu := NewM6502(mem, cycles)
+
+	if variant != NMOS6502 {
+		cpu.SetVariant(variant)
+	}
+
+	return cpu
+}
+
 // Resets the CPU by resetting both the registers and memory.
 func (cpu *M6502) Reset() {
-	cpu.Registers.Reset()
+	cpu.cycles = 0
+	cpu.resetRegisters()
 	cpu.Memory.Reset()
 	cpu.PerformRst()
 }
 
+// Performs the 6502's reset sequence, as asserting its RES line does,
+// and returns the number of cycles consumed, which is 7.  SP is set to
+// 0xfd, the I flag is set and PC is loaded from the reset vector at
+// 0xfffc.  Unlike Reset, WarmReset neither clears memory nor zeroes
+// CycleCount.
+func (cpu *M6502) WarmReset() (cycles uint16) {
+	cpu.resetRegisters()
+	cpu.PerformRst()
+
+	return 7
+}
+
+func (cpu *M6502) resetRegisters() {
+	p := cpu.Registers.P
+
+	cpu.Registers.Reset()
+
+	if cpu.keepFlags {
+		cpu.Registers.P = p | I
+	}
+}
+
 func (cpu *M6502) Interrupt(which Interrupt, state bool) {
 	switch which {
 	case Irq:
@@ -149,7 +413,7 @@ func (cpu *M6502) InterruptLine(which Interrupt) func(state bool) {
 func (cpu *M6502) GetInterrupt(which Interrupt) (state bool) {
 	switch which {
 	case Irq:
-		state = cpu.Irq
+		state = cpu.irqAsserted()
 	case Nmi:
 		state = cpu.Nmi
 	case Rst:
@@ -159,125 +423,894 @@ func (cpu *M6502) GetInterrupt(which Interrupt) (state bool) {
 	return
 }
 
-func (cpu *M6502) PerformInterrupts() {
+// Services any pending interrupt and returns the number of cycles
+// consumed.  Servicing an IRQ or NMI pushes PCH, PCL and then P to the
+// stack and loads PC from the interrupt's vector, which takes 7
+// cycles.
+func (cpu *M6502) PerformInterrupts() (cycles uint16) {
 	// check interrupts
 	switch {
-	case cpu.Irq && cpu.Registers.P&I == 0:
-		cpu.PerformIrq()
-		cpu.Irq = false
 	case cpu.Nmi:
-		cpu.PerformNmi()
+		cycles = cpu.NMI()
 		cpu.Nmi = false
+	case cpu.irqAsserted() && cpu.Registers.P&I == 0:
+		cycles = cpu.IRQ()
+		cpu.Irq = false
 	case cpu.Rst:
 		cpu.PerformRst()
 		cpu.Rst = false
 	}
+
+	return
+}
+
+// Sets the state of the IRQ line, which is polled between
+// instructions.  The line is level-triggered: while it is asserted an
+// IRQ is serviced before the next instruction whenever the I flag is
+// clear, so it fires again after RTI unless the handler has the
+// device release the line with SetIRQ(false).  Unlike the Irq field,
+// which is cleared once its IRQ has been serviced, the line stays
+// asserted until SetIRQ(false) is called.
+func (cpu *M6502) SetIRQ(state bool) {
+	cpu.irqLine = state
+}
+
+// Returns whether an IRQ is pending, either latched in the Irq field
+// or held by the IRQ line.
+func (cpu *M6502) irqAsserted() bool {
+	return cpu.Irq || cpu.irqLine
 }
 
+// Services a maskable interrupt if the I flag is clear and returns the
+// number of cycles consumed, which is 7, or 0 if the interrupt is
+// masked.
+func (cpu *M6502) IRQ() (cycles uint16) {
+	if cpu.Registers.P&I != 0 {
+		return 0
+	}
+
+	cpu.PerformIrq()
+
+	return 7
+}
+
+// Services a maskable interrupt regardless of the I flag.  PCH, PCL
+// and then P, with B clear, are pushed to the stack, the I flag is
+// set and PC is loaded from the IRQ vector at 0xfffe.
 func (cpu *M6502) PerformIrq() {
 	cpu.push16(cpu.Registers.PC)
-	cpu.push(uint8(cpu.Registers.P))
+	cpu.push(uint8((cpu.Registers.P &^ B) | U))
 
-	low := cpu.Memory.Fetch(0xfffe)
-	high := cpu.Memory.Fetch(0xffff)
+	cpu.halted = false
+	cpu.Registers.P |= I
+	cpu.clearDecimalOnInterrupt()
+	cpu.Registers.PC = cpu.vector(0xfffe)
+}
 
-	cpu.Registers.PC = (uint16(high) << 8) | uint16(low)
+// Latches a non-maskable interrupt.  NMI is edge-triggered, so the
+// latch is serviced exactly once before the next instruction and is
+// then cleared until SetNMI is called again.
+func (cpu *M6502) SetNMI() {
+	cpu.Interrupt(Nmi, true)
 }
 
+// Services a non-maskable interrupt regardless of the I flag and
+// returns the number of cycles consumed, which is 7.
+func (cpu *M6502) NMI() (cycles uint16) {
+	cpu.PerformNmi()
+
+	return 7
+}
+
+// Services a non-maskable interrupt.  PCH, PCL and then P, with B
+// clear, are pushed to the stack, the I flag is set and PC is loaded
+// from the NMI vector at 0xfffa.
 func (cpu *M6502) PerformNmi() {
 	cpu.push16(cpu.Registers.PC)
-	cpu.push(uint8(cpu.Registers.P))
+	cpu.push(uint8((cpu.Registers.P &^ B) | U))
+
+	cpu.halted = false
+	cpu.Registers.P |= I
+	cpu.clearDecimalOnInterrupt()
+	cpu.Registers.PC = cpu.vector(0xfffa)
+}
+
+// Clears the D flag when entering an interrupt handler on the 65C02.
+// The NMOS 6502 leaves it unchanged.
+func (cpu *M6502) clearDecimalOnInterrupt() {
+	if cpu.variant == CMOS65C02 {
+		cpu.Registers.P &^= D
+	}
+}
+
+// Returns the 16-bit address stored at 'address', the location of an
+// interrupt vector.
+func (cpu *M6502) vector(address uint16) (result uint16) {
+	result = Fetch16(cpu.Memory, address)
+	cpu.checkVector(address, result)
+
+	return
+}
+
+func (cpu *M6502) checkVector(address uint16, target uint16) {
+	if cpu.badVector != nil && target == 0x0000 {
+		cpu.badVector(address)
+	}
+}
+
+func (cpu *M6502) PerformRst() {
+	cpu.halted = false
+	cpu.jammed = false
+	cpu.Registers.PC = cpu.vector(0xfffc)
+}
+
+// Halts the CPU until an interrupt arrives, as the 65C02's WAI
+// instruction does.  While halted, Execute neither fetches nor
+// executes instructions and the PC register does not advance; each
+// call instead consumes the number of cycles set with SetHaltCycles.
+// Servicing an IRQ or NMI, or a reset, resumes execution.  An IRQ
+// asserted while the I flag is set also resumes execution, at the
+// next instruction, without being serviced.
+func (cpu *M6502) Halt() {
+	cpu.halted = true
+}
+
+// Returns whether the CPU is halted, either by Halt or by a KIL
+// opcode.
+func (cpu *M6502) Halted() bool {
+	return cpu.halted || cpu.jammed
+}
+
+// Sets the number of cycles each call to Execute consumes while the
+// CPU is halted.  The default is 1.  With 0, Run and the other Run
+// methods return ErrHalted once the CPU is halted rather than spin
+// without ever advancing time.
+func (cpu *M6502) SetHaltCycles(cycles uint16) {
+	cpu.haltCycles = cycles
+}
+
+// Returns a copy of the CPU's registers, which can later be passed to
+// RestoreRegisters.  This is much cheaper than copying memory when
+// only the registers need to be rewound.
+func (cpu *M6502) SnapshotRegisters() Registers {
+	return cpu.Registers
+}
+
+// Sets the CPU's registers to those returned by SnapshotRegisters.
+func (cpu *M6502) RestoreRegisters(reg Registers) {
+	cpu.Registers = reg
+}
+
+// Sets the PC register to 'addr'.  This is the quick way to start
+// execution at a known address after loading a program, without
+// having to store the address in the reset vector and call Reset.
+func (cpu *M6502) SetPC(addr uint16) {
+	cpu.Registers.PC = addr
+}
+
+// Causes Reset to only set the I flag, leaving the other flags as
+// they were.  This is closer to real hardware, where reset forces I
+// but leaves the other flags undefined, than the default of clearing
+// every flag except I.
+func (cpu *M6502) EnableFlagPreservingReset() {
+	cpu.keepFlags = true
+}
+
+// Restores the default of clearing every flag except I on Reset after
+// a call to EnableFlagPreservingReset.
+func (cpu *M6502) DisableFlagPreservingReset() {
+	cpu.keepFlags = false
+}
+
+func (cpu *M6502) DisableDecimalMode() {
+	cpu.decimalMode = false
+}
+
+func (cpu *M6502) EnableDecode() {
+	cpu.decode.enabled = true
+}
+
+// Sets the Tracer which receives a line for each instruction executed
+// while decoding is enabled.  Passing nil restores the default of
+// printing each line to standard output.
+func (cpu *M6502) SetTracer(tracer Tracer) {
+	cpu.decode.tracer = tracer
+}
+
+// Disables cycle counting.  Execute no longer adds to CycleCount and
+// Run no longer reports the cycles consumed by each instruction on
+// the Cycles channel, checks the cycle breakpoint or totals the
+// cycles returned by RunCount, which returns 0.  The CPU simply
+// fetches, decodes and executes instructions as fast as possible.
+// Any feature that depends on cycle timing, such as pacing the CPU
+// against other chips, timed interrupts or SetCycleBreakpoint, is
+// unavailable in this mode.
+func (cpu *M6502) DisableCycleCounting() {
+	cpu.noCycles = true
+}
+
+// Re-enables cycle counting after a call to DisableCycleCounting.
+func (cpu *M6502) EnableCycleCounting() {
+	cpu.noCycles = false
+}
+
+// Stops the CPU from forcing the unused bit 5 of the P register to 1.
+// By default bit 5 always reads as 1, as it does on real hardware,
+// regardless of whether P was assigned directly or restored by PLP or
+// RTI.  Once disabled, bit 5 holds whatever value was last stored in
+// it.
+func (cpu *M6502) DisableUnusedBitForcing() {
+	cpu.rawUnused = true
+}
+
+// Re-enables forcing the unused bit 5 of the P register to 1 after a
+// call to DisableUnusedBitForcing.
+func (cpu *M6502) EnableUnusedBitForcing() {
+	cpu.rawUnused = false
+}
+
+func (cpu *M6502) forceUnused() {
+	if !cpu.rawUnused {
+		cpu.Registers.P |= U
+	}
+}
+
+// Enables modeling of the 6502's branch interrupt polling quirk.  A
+// taken branch which does not cross a page polls for interrupts
+// before its final cycle rather than after it, so an interrupt which
+// arrives while such a branch is executing is not serviced until
+// after the following instruction has executed.  Taken branches which
+// cross a page and untaken branches poll for interrupts as usual.
+func (cpu *M6502) EnableBranchInterruptDelay() {
+	cpu.branchDelay = true
+}
+
+// Disables modeling of the branch interrupt polling quirk after a
+// call to EnableBranchInterruptDelay.
+func (cpu *M6502) DisableBranchInterruptDelay() {
+	cpu.branchDelay = false
+	cpu.delayPoll = false
+}
+
+// Enables a guard against dereferencing null pointers.  Once enabled,
+// any instruction using the (indirect,X) or (indirect),Y addressing
+// modes whose zero page pointer holds 0x0000 causes Execute to return
+// a NullPointerError after the instruction has executed, which stops
+// Run.
+func (cpu *M6502) EnableNullPointerTrap() {
+	cpu.nullTrap = true
+}
+
+// Disables the null pointer guard after a call to
+// EnableNullPointerTrap.
+func (cpu *M6502) DisableNullPointerTrap() {
+	cpu.nullTrap = false
+}
+
+// Sets the member of the 6502 family to emulate, which is NMOS6502 by
+// default.  Besides the instruction set, the variant decides whether
+// JMP ($xxFF) reads its high byte from $xx00, as the NMOS 6502 does,
+// and whether interrupts and BRK clear the D flag, as the 65C02 does.
+// The Instructions table is rebuilt for the variant, so any
+// instructions added to it or removed from it are lost.
+func (cpu *M6502) SetVariant(variant Variant) {
+	cpu.variant = variant
+
+	cpu.Instructions = NewInstructionTable()
+	cpu.Instructions.InitVariantInstructions(variant)
+}
+
+// Returns the member of the 6502 family being emulated.
+func (cpu *M6502) Variant() Variant {
+	return cpu.variant
+}
+
+// Returns the opcode's description for the emulated variant.
+func (cpu *M6502) opcodeInfo(opcode OpCode) opcodeInfo {
+	if cpu.variant == CMOS65C02 && cmosOpcodes[opcode].mnemonic != "" {
+		return cmosOpcodes[opcode]
+	}
+
+	return opcodes[opcode]
+}
+
+// Enables the NMOS 6502's undocumented opcodes, such as LAX, SAX, DCP
+// and ISB (also known as ISC), the unofficial forms of NOP and the KIL
+// opcodes that jam the CPU.  By default Execute returns a
+// BadOpCodeError for them, as it does for undefined opcodes.
+func (cpu *M6502) EnableIllegalOpcodes() {
+	cpu.illegalOps = true
+}
+
+// Disables the undocumented opcodes after a call to
+// EnableIllegalOpcodes.
+func (cpu *M6502) DisableIllegalOpcodes() {
+	cpu.illegalOps = false
+}
+
+// Enables strict PC checking.  Once enabled, Execute returns a
+// PCWrapError instead of executing an instruction whose operand bytes
+// would wrap around from 0xffff to 0x0000, which usually means a
+// runaway program.  By default such instructions are executed,
+// reading their operands from the bottom of memory as the 6502 does.
+func (cpu *M6502) EnableStrictPC() {
+	cpu.strictPC = true
+}
+
+// Disables strict PC checking after a call to EnableStrictPC.
+func (cpu *M6502) DisableStrictPC() {
+	cpu.strictPC = false
+}
+
+// Causes Run and RunCount to stop right before executing the
+// instruction which would push the cumulative cycle count, as
+// returned by CycleCount, past 'cycle', returning a
+// CycleBreakpointError.  The cost of the next instruction is taken to
+// be its base cycle count plus the cycles for servicing any pending
+// NMI or unmasked IRQ, ignoring any page crossing or branch
+// penalties.  Since the count keeps growing, a run stopped at the
+// breakpoint stops again right away until the breakpoint is moved or
+// removed.  A 'cycle' of zero removes the breakpoint.
+func (cpu *M6502) SetCycleBreakpoint(cycle uint64) {
+	cpu.breakCycle = cycle
+}
+
+// Returns the cumulative number of cycles executed by the CPU through
+// Execute and ExecuteOpcode, including servicing interrupts, since it
+// was created or last Reset.
+func (cpu *M6502) CycleCount() uint64 {
+	return cpu.cycles
+}
+
+// Returns the base number of cycles the next instruction will take,
+// including servicing a pending NMI or unmasked IRQ beforehand.
+func (cpu *M6502) nextCycles() (cycles uint64) {
+	pc := cpu.Registers.PC
+
+	if !cpu.delayPoll {
+		switch {
+		case cpu.Nmi:
+			cycles, pc = 7, Fetch16(cpu.Memory, 0xfffa)
+		case cpu.irqAsserted() && cpu.Registers.P&I == 0:
+			cycles, pc = 7, Fetch16(cpu.Memory, 0xfffe)
+		}
+	}
+
+	return cycles + uint64(cpu.opcodeInfo(OpCode(cpu.Memory.Fetch(pc))).cycles)
+}
+
+// Causes Run and RunUntilBreak to stop right before executing the
+// instruction at 'addr', returning a BreakpointError from Run.  The
+// first instruction of a run is never stopped at, so calling Run again
+// resumes execution from a breakpoint.
+func (cpu *M6502) SetBreakpoint(addr uint16) {
+	cpu.breakpoints[addr] = true
+}
+
+// Removes a breakpoint previously set with SetBreakpoint.
+func (cpu *M6502) ClearBreakpoint(addr uint16) {
+	delete(cpu.breakpoints, addr)
+}
 
-	low := cpu.Memory.Fetch(0xfffa)
-	high := cpu.Memory.Fetch(0xfffb)
+// Registers a function to be called whenever executing an instruction
+// changes the P register.  The function receives the value of P
+// before and after the instruction was executed.  Passing nil removes
+// any previously registered function.
+func (cpu *M6502) OnFlagChange(fn func(old, new Status)) {
+	cpu.flagChange = fn
+}
+
+// Registers a function to be called whenever an instruction reads an
+// operand from the stack page (0x0100-0x01ff) as data rather than
+// pulling it from the stack.  Such reads usually indicate a corrupted
+// SP register.  'pc' is the address of the instruction and 'address'
+// the address read.  Immediate operands are not reported.  Passing
+// nil disables the tracking.
+func (cpu *M6502) OnStackDataRead(fn func(pc uint16, address uint16)) {
+	cpu.stackRead = fn
+}
+
+// Registers a function to be called whenever SED executes while
+// decimal mode is disabled, as it is on the NES's 2A03.  Code which
+// sets the D flag on such a CPU was usually ported from a 6502 with
+// decimal mode and likely relies on it.  'pc' is the address of the
+// SED instruction.  Passing nil removes any previously registered
+// function.
+func (cpu *M6502) OnDecimalModeUse(fn func(pc uint16)) {
+	cpu.decimalUse = fn
+}
+
+// Registers a function to be called whenever an indirect JMP, BRK or
+// interrupt jumps through a vector which holds 0x0000.  Such a vector
+// has almost certainly never been written, which indicates a setup
+// bug.  'vector' is the address of the vector.  Passing nil disables
+// the check.
+func (cpu *M6502) OnUninitializedVector(fn func(vector uint16)) {
+	cpu.badVector = fn
+}
+
+// Registers a function to be called after each instruction is
+// executed with its opcode and the number of cycles it consumed.  The
+// value returned is used as the instruction's cycle count instead,
+// which allows the host to model wait states depending on the memory
+// the instruction accessed.  Passing nil removes any previously
+// registered function.
+func (cpu *M6502) SetCycleAdjuster(fn func(cpu *M6502, op OpCode, baseCycles uint16) uint16) {
+	cpu.adjustCycles = fn
+}
+
+// Registers a function to be called after each instruction is
+// executed with the number of cycles it consumed.  This allows the
+// host to advance other chips in lockstep with the CPU.  Passing nil
+// removes any previously registered function.
+func (cpu *M6502) SetPostExecHook(fn func(cpu *M6502, cycles uint16)) {
+	cpu.postExec = fn
+}
+
+// Error type used to indicate that the CPU attempted to execute an
+// invalid opcode
+type BadOpCodeError OpCode
+
+func (b BadOpCodeError) Error() string {
+	return fmt.Sprintf("No such opcode %#02x", uint8(b))
+}
+
+// Error type used to indicate that the CPU is jammed after executing
+// one of the NMOS 6502's KIL opcodes while undocumented opcodes are
+// enabled.  The 65C02 has no KIL opcodes.  The PC register is left
+// pointing at the KIL opcode, which is also the value, and Execute
+// keeps returning a CPUJammedError, without servicing IRQs or NMIs,
+// until the CPU is reset.
+type CPUJammedError uint16
+
+func (c CPUJammedError) Error() string {
+	return fmt.Sprintf("CPU jammed at $%04X", uint16(c))
+}
+
+// Error type used to indicate that the CPU executed a BRK instruction
+type BrkOpCodeError OpCode
+
+func (b BrkOpCodeError) Error() string {
+	return fmt.Sprintf("Executed BRK opcode")
+}
+
+// Error type used to indicate that an instruction dereferenced a zero
+// page pointer holding 0x0000.  The value is the zero page address of
+// the pointer.
+type NullPointerError uint8
+
+func (n NullPointerError) Error() string {
+	return fmt.Sprintf("Null pointer dereferenced through $%02X", uint8(n))
+}
+
+// Error type used to indicate that an instruction's operand bytes
+// would wrap around the address space while strict PC checking is
+// enabled.  The value is the address of the instruction.
+type PCWrapError uint16
+
+func (p PCWrapError) Error() string {
+	return fmt.Sprintf("Instruction at $%04X wraps past $FFFF", uint16(p))
+}
+
+// Error type used to indicate that a run stopped at a cycle
+// breakpoint.  The value is the cumulative cycle count, as returned by
+// CycleCount, when the run stopped.
+type CycleBreakpointError uint64
+
+func (c CycleBreakpointError) Error() string {
+	return fmt.Sprintf("Cycle breakpoint reached after %d cycles", uint64(c))
+}
+
+// Error type used to indicate that a run stopped at a breakpoint set
+// with SetBreakpoint.  The value is the address of the breakpoint.
+type BreakpointError uint16
+
+func (b BreakpointError) Error() string {
+	return fmt.Sprintf("Breakpoint reached at 0x%04X", uint16(b))
+}
+
+// Executes the instruction pointed to by the PC register in the
+// number of cycles as returned by the instruction's Exec function.  If
+// an interrupt is serviced before the instruction, the cycles it
+// consumed are included.  Returns the number of cycles executed and
+// any error (such as BadOpCodeError).  Execute never hands cycles over
+// the Cycles channel; only Run and the other Run methods do, so a
+// debugger or test can execute instructions without anything
+// consuming the channel.
+func (cpu *M6502) Execute() (cycles uint16, error error) {
+	result, error := cpu.step()
+	return result.Cycles, error
+}
+
+// Executes the single instruction pointed to by the PC register.
+// Step is the same as Execute and, like it, never blocks on the
+// Cycles channel.
+func (cpu *M6502) Step() (cycles uint16, error error) {
+	return cpu.Execute()
+}
 
-	cpu.Registers.PC = (uint16(high) << 8) | uint16(low)
+// Represents the outcome of executing a single instruction.
+type StepResult struct {
+	PC        uint16    // address the instruction was fetched from
+	OpCode    OpCode    // opcode of the instruction
+	Cycles    uint16    // number of cycles executed, including servicing an interrupt
+	Registers Registers // registers after the instruction executed
 }
 
-func (cpu *M6502) PerformRst() {
-	low := cpu.Memory.Fetch(0xfffc)
-	high := cpu.Memory.Fetch(0xfffd)
+// Executes a single instruction exactly as Execute does and writes a
+// trace line for it to 'w', in the same format used when decoding is
+// enabled.  Returns the StepResult for the instruction and any error
+// (such as BadOpCodeError).
+func (cpu *M6502) StepTrace(w io.Writer) (result StepResult, error error) {
+	enabled, tracer := cpu.decode.enabled, cpu.decode.tracer
+	cpu.decode.enabled, cpu.decode.tracer = true, NewWriterTracer(w)
+
+	result, error = cpu.step()
+
+	cpu.decode.enabled, cpu.decode.tracer = enabled, tracer
+	return
+}
+
+// Executes up to 'n' instructions exactly as Execute does and returns
+// the StepResult for each of them.  Execution stops early if an
+// instruction returns an error, in which case the last StepResult is
+// for that instruction.
+func (cpu *M6502) Trace(n int) (results []StepResult, error error) {
+	var result StepResult
+
+	for i := 0; i < n; i++ {
+		result, error = cpu.step()
+		results = append(results, result)
+
+		if error != nil {
+			break
+		}
+	}
+
+	return
+}
+
+func (cpu *M6502) step() (result StepResult, error error) {
+	defer func() { cpu.addCycles(result.Cycles) }()
+
+	protected, _ := cpu.Memory.(protectedMemory)
+
+	if protected != nil {
+		protected.violation()
+	}
+
+	var interrupt uint16
+
+	if cpu.jammed {
+		if !cpu.Rst {
+			result.PC = cpu.Registers.PC
+			result.Registers = cpu.Registers
+			return result, CPUJammedError(result.PC)
+		}
+
+		cpu.PerformRst()
+		cpu.Rst = false
+	}
+
+	if cpu.halted && cpu.irqAsserted() && cpu.Registers.P&I != 0 {
+		cpu.halted = false
+	}
+
+	// check interrupts
+	if cpu.delayPoll {
+		cpu.delayPoll = false
+	} else {
+		interrupt = cpu.PerformInterrupts()
+	}
+
+	if cpu.halted {
+		result.PC = cpu.Registers.PC
+		result.Cycles = cpu.haltCycles
+		result.Registers = cpu.Registers
+		return
+	}
+
+	// fetch
+	result.PC = cpu.Registers.PC
+	result.OpCode = OpCode(cpu.Memory.Fetch(result.PC))
+
+	if protected != nil && !protected.executable(result.PC) {
+		result.Cycles = interrupt
+		result.Registers = cpu.Registers
+		return result, ExecuteProtectionError(result.PC)
+	}
+
+	if cpu.strictPC && uint32(result.PC)+1+uint32(cpu.opcodeInfo(result.OpCode).mode.OperandSize()) > 0x10000 {
+		result.Cycles = interrupt
+		result.Registers = cpu.Registers
+		return result, PCWrapError(result.PC)
+	}
+
+	result.Cycles, error = cpu.execute(result.PC, result.OpCode, protected)
+	result.Cycles += interrupt
+	result.Registers = cpu.Registers
+
+	return
+}
+
+// Executes the instruction for the given opcode as if it had just
+// been fetched, without reading the opcode from memory or checking
+// for interrupts.  Any operands are read from memory starting at the
+// PC register as usual, so the PC register should point to the byte
+// following where the opcode would be.  Returns the number of cycles
+// executed, which are added to CycleCount as they are by Execute, and
+// any error (such as BadOpCodeError).
+func (cpu *M6502) ExecuteOpcode(opcode OpCode) (cycles uint16, error error) {
+	if cpu.jammed {
+		return 0, CPUJammedError(cpu.Registers.PC)
+	}
+
+	protected, _ := cpu.Memory.(protectedMemory)
+
+	if protected != nil {
+		protected.violation()
+	}
+
+	cycles, error = cpu.execute(cpu.Registers.PC-1, opcode, protected)
+	cpu.addCycles(cycles)
+
+	return
+}
+
+// Adds 'cycles' to the count returned by CycleCount, unless cycle
+// counting is disabled.
+func (cpu *M6502) addCycles(cycles uint16) {
+	if !cpu.noCycles {
+		cpu.cycles += uint64(cycles)
+	}
+}
+
+// Executes the instruction for the given opcode.  'protected' is the
+// CPU's Memory if it is a protectedMemory, or nil, so that the type
+// assertion is done once per instruction by the caller.
+func (cpu *M6502) execute(pc uint16, opcode OpCode, protected protectedMemory) (cycles uint16, error error) {
+	inst := cpu.Instructions.lookup(opcode)
+	ok := inst != nil
+
+	if !ok && cpu.illegalOps && cpu.variant == NMOS6502 && opcode.IsJam() {
+		cpu.Registers.PC = pc
+		cpu.jammed = true
+		return 0, CPUJammedError(pc)
+	}
+
+	if !ok || inst.illegal && !cpu.illegalOps {
+		return 0, BadOpCodeError(opcode)
+	}
+
+	cpu.forceUnused()
+
+	// execute
+	if cpu.decode.enabled {
+		cpu.decode.pc = pc
+		cpu.decode.opcode = opcode
+		cpu.decode.args = ""
+		cpu.decode.mneumonic = inst.Mneumonic
+		cpu.decode.decodedArgs = ""
+		cpu.decode.registers = cpu.Registers.trace()
+	}
+
+	p := cpu.Registers.P
+
+	cpu.instPC = pc
+	cpu.instOpCode = opcode
+
+	cpu.Registers.PC = pc + 1
+	cycles = inst.Exec(cpu, inst)
+
+	if cpu.adjustCycles != nil {
+		cycles = cpu.adjustCycles(cpu, opcode, cycles)
+	}
+
+	if cpu.flagChange != nil && cpu.Registers.P != p {
+		cpu.flagChange(p, cpu.Registers.P)
+	}
+
+	if protected != nil {
+		if err := protected.violation(); err != nil && cpu.fault == nil {
+			cpu.fault = err
+		}
+	}
+
+	if cpu.postExec != nil {
+		cpu.postExec(cpu, cycles)
+	}
+
+	if cpu.decode.enabled {
+		cpu.decode.print()
+	}
+
+	if cpu.fault != nil {
+		error, cpu.fault = cpu.fault, nil
+		return cycles, error
+	}
+
+	if cpu.breakError && opcode == 0x00 {
+		return cycles, BrkOpCodeError(opcode)
+	}
+
+	return cycles, nil
+}
+
+// Executes instruction until Execute() returns an error.
+func (cpu *M6502) Run() (err error) {
+	_, err = cpu.RunCount()
+	return
+}
+
+// Executes instructions until Execute() returns an error, exactly as
+// Run does.  Returns the total number of cycles executed along with
+// the error.
+func (cpu *M6502) RunCount() (total uint64, err error) {
+	total, _, err = cpu.run(0)
+	return
+}
+
+// Executes instructions exactly as Run does until the PC register
+// reaches a breakpoint set with SetBreakpoint, without executing the
+// instruction there.  Returns the address of the breakpoint, or the
+// PC register and the error if Execute() returns an error first.
+func (cpu *M6502) RunUntilBreak() (pc uint16, err error) {
+	_, _, err = cpu.run(0)
+
+	if b, ok := err.(BreakpointError); ok {
+		return uint16(b), nil
+	}
+
+	return cpu.Registers.PC, err
+}
+
+// Error returned by RunLimited when the instruction limit is reached.
+var ErrInstructionLimit = errors.New("Instruction limit reached")
+
+// Error returned by Run and the other Run methods when the CPU is
+// halted and SetHaltCycles(0) leaves nothing to wake it.
+var ErrHalted = errors.New("CPU halted")
+
+// Executes instructions exactly as Run does, but stops with
+// ErrInstructionLimit once 'maxInstructions' instructions have been
+// executed.  This guards against runaway programs which never return
+// an error.  Returns the number of instructions executed without error
+// along with the error.
+func (cpu *M6502) RunLimited(maxInstructions uint64) (executed uint64, err error) {
+	if maxInstructions == 0 {
+		return 0, ErrInstructionLimit
+	}
+
+	_, executed, err = cpu.run(maxInstructions)
+	return
+}
+
+// Executes whole instructions exactly as Run does until at least
+// 'budget' cycles have elapsed or Execute() returns an error.  This
+// allows a scheduler to interleave the CPU with other chips in bounded
+// slices.  Returns the number of cycles actually executed, which may
+// exceed 'budget' by up to one instruction but saturates at 0xffff,
+// along with any error.
+func (cpu *M6502) RunCycles(budget uint16) (executed uint16, err error) {
+	var cycles uint16
+	var total uint32
+
+	for total < uint32(budget) {
+		cycles, err = cpu.Execute()
+		total += uint32(cycles)
+
+		if err != nil {
+			break
+		}
+
+		if cycles == 0 && cpu.halted {
+			err = ErrHalted
+			break
+		}
+
+		cpu.handshake(cycles)
+	}
+
+	if total > 0xffff {
+		total = 0xffff
+	}
+
+	return uint16(total), err
+}
+
+// Executes instructions until Execute() returns an error or, if
+// 'limit' is non-zero, until 'limit' instructions have been executed.
+func (cpu *M6502) run(limit uint64) (total uint64, executed uint64, err error) {
+	var cycles uint16
+
+	for {
+		if limit != 0 && executed == limit {
+			err = ErrInstructionLimit
+			return
+		}
+
+		if executed != 0 && cpu.breakpoints[cpu.Registers.PC] {
+			err = BreakpointError(cpu.Registers.PC)
+			return
+		}
+
+		if !cpu.noCycles && cpu.breakCycle != 0 && cpu.cycles+cpu.nextCycles() > cpu.breakCycle {
+			err = CycleBreakpointError(cpu.cycles)
+			return
+		}
+
+		cycles, err = cpu.Execute()
 
-	cpu.Registers.PC = (uint16(high) << 8) | uint16(low)
-}
+		if !cpu.noCycles {
+			total += uint64(cycles)
+		}
 
-func (cpu *M6502) DisableDecimalMode() {
-	cpu.decimalMode = false
-}
+		if err != nil {
+			return
+		}
 
-func (cpu *M6502) EnableDecode() {
-	cpu.decode.enabled = true
-}
+		if cycles == 0 && cpu.halted {
+			err = ErrHalted
+			return
+		}
 
-// Error type used to indicate that the CPU attempted to execute an
-// invalid opcode
-type BadOpCodeError OpCode
+		executed++
 
-func (b BadOpCodeError) Error() string {
-	return fmt.Sprintf("No such opcode %#02x", b)
+		cpu.handshake(cycles)
+	}
 }
 
-// Error type used to indicate that the CPU executed a BRK instruction
-type BrkOpCodeError OpCode
+// Executes instructions for the wall-clock duration 'd', or until
+// Execute() returns an error, and returns the effective clock speed
+// in MHz, i.e. the number of cycles executed per microsecond.  This
+// is useful for checking that an integration keeps up with its target
+// clock rate.
+func (cpu *M6502) MeasureSpeed(d time.Duration) (mhz float64, err error) {
+	var cycles uint16
+	var total uint64
 
-func (b BrkOpCodeError) Error() string {
-	return fmt.Sprintf("Executed BRK opcode")
-}
+	start := time.Now()
+	elapsed := time.Duration(0)
 
-// Executes the instruction pointed to by the PC register in the
-// number of cycles as returned by the instruction's Exec function.
-// Returns the number of cycles executed and any error (such as
-// BadOpCodeError).
-func (cpu *M6502) Execute() (cycles uint16, error error) {
-	// check interrupts
-	cpu.PerformInterrupts()
+	for elapsed < d {
+		cycles, err = cpu.Execute()
+		total += uint64(cycles)
+		elapsed = time.Since(start)
 
-	// fetch
-	opcode := OpCode(cpu.Memory.Fetch(cpu.Registers.PC))
-	inst, ok := cpu.Instructions[opcode]
+		if err != nil {
+			break
+		}
 
-	if !ok {
-		return 0, BadOpCodeError(opcode)
+		cpu.handshake(cycles)
 	}
 
-	// execute
-	if cpu.decode.enabled {
-		cpu.decode.pc = cpu.Registers.PC
-		cpu.decode.opcode = opcode
-		cpu.decode.args = ""
-		cpu.decode.mneumonic = inst.Mneumonic
-		cpu.decode.decodedArgs = ""
-		cpu.decode.registers = cpu.Registers.String()
+	if elapsed > 0 {
+		mhz = float64(total) / (float64(elapsed) / float64(time.Microsecond))
 	}
 
-	cpu.Registers.PC++
-	cycles = inst.Exec(cpu)
+	return
+}
 
-	if cpu.decode.enabled {
-		fmt.Println(cpu.decode.String())
+// Hands the number of cycles used by an instruction over the Cycles
+// channel and waits for the reply, unless cycle counting is disabled.
+func (cpu *M6502) handshake(cycles uint16) {
+	if cpu.noCycles {
+		return
 	}
 
-	if cpu.breakError && opcode == 0x00 {
-		return cycles, BrkOpCodeError(opcode)
+	if cpu.Cycles != nil && cycles != 0 {
+		cpu.Cycles <- cycles
+		<-cpu.Cycles
 	}
-
-	return cycles, nil
 }
 
-// Executes instruction until Execute() returns an error.
-func (cpu *M6502) Run() (err error) {
-	var cycles uint16
-
-	for {
-		if cycles, err = cpu.Execute(); err != nil {
-			return
-		}
-
-		if cpu.Cycles != nil && cycles != 0 {
-			cpu.Cycles <- cycles
-			<-cpu.Cycles
-		}
+// Returns 1 if the carry flag is set and 0 otherwise.
+func (cpu *M6502) CarryValue() uint8 {
+	if cpu.Registers.P&C != 0 {
+		return 1
 	}
+
+	return 0
 }
 
 func (cpu *M6502) setZFlag(value uint8) uint8 {
@@ -349,162 +1382,50 @@ func (cpu *M6502) controlAddress(opcode OpCode, cycles *uint16) (address uint16)
 	return
 }
 
-func (cpu *M6502) aluAddress(opcode OpCode, cycles *uint16) (address uint16) {
-	// alu opcodes end with 01
-
-	if opcode&0x10 == 0 {
-		switch (opcode >> 2) & 0x03 {
-		case 0x00:
-			*cycles = 6
-			address = cpu.indexedIndirectAddress()
-		case 0x01:
-			*cycles = 3
-			address = cpu.zeroPageAddress()
-		case 0x02:
-			*cycles = 2
-			address = cpu.immediateAddress()
-		case 0x03:
-			*cycles = 4
-			address = cpu.absoluteAddress()
-		}
-	} else {
-		switch (opcode >> 2) & 0x03 {
-		case 0x00:
-			*cycles = 5
-			address = cpu.indirectIndexedAddress(cycles)
-		case 0x01:
-			*cycles = 4
-			address = cpu.zeroPageIndexedAddress(X)
-		case 0x02:
-			*cycles = 4
-			address = cpu.absoluteIndexedAddress(Y, cycles)
-		case 0x03:
-			*cycles = 4
-			address = cpu.absoluteIndexedAddress(X, cycles)
-		}
-	}
-
-	return
-}
-
-func (cpu *M6502) rmwAddress(opcode OpCode, cycles *uint16) (address uint16) {
-	// rmw opcodes end with 10
-	var index Index
-
-	if opcode&0x10 == 0 {
-		switch (opcode >> 2) & 0x03 {
-		case 0x00:
-			*cycles = 2
-			address = cpu.immediateAddress()
-		case 0x01:
-			*cycles = 3
-			address = cpu.zeroPageAddress()
-		case 0x02:
-			*cycles = 2
-			address = 0 // not used
-		case 0x03:
-			*cycles = 4
-			address = cpu.absoluteAddress()
-		}
-	} else {
-		switch (opcode >> 2) & 0x03 {
-		case 0x00:
-			*cycles = 2
-			address = 0 // not used
-		case 0x01:
-			*cycles = 4
-
-			switch opcode & 0xf0 {
-			case 0x90:
-				fallthrough
-			case 0xb0:
-				index = Y
-			default:
-				index = X
-			}
-
-			address = cpu.zeroPageIndexedAddress(index)
-		case 0x02:
-			*cycles = 2
-			address = 0 // not used
-		case 0x03:
-			*cycles = 4
+// Returns the effective address of the instruction's operand in its
+// addressing mode and sets 'cycles' to the instruction's cycles,
+// adding a cycle when an index crosses a page boundary for
+// instructions that take one.  Implied and accumulator mode
+// instructions have no operand address.
+func (cpu *M6502) address(inst *Instruction, cycles *uint16) (address uint16) {
+	*cycles = uint16(inst.cycles)
 
-			switch opcode & 0xf0 {
-			case 0x90:
-				fallthrough
-			case 0xb0:
-				index = Y
-			default:
-				index = X
-			}
+	page := cycles
 
-			address = cpu.absoluteIndexedAddress(index, cycles)
-		}
+	if !inst.pageCross {
+		page = nil
 	}
 
-	return
-}
-
-func (cpu *M6502) unofficialAddress(opcode OpCode, cycles *uint16) (address uint16) {
-	// alu opcodes end with 11
-	var index Index
-
-	if opcode&0x10 == 0 {
-		switch (opcode >> 2) & 0x03 {
-		case 0x00:
-			*cycles = 8
-			address = cpu.indexedIndirectAddress()
-		case 0x01:
-			*cycles = 5
-			address = cpu.zeroPageAddress()
-		case 0x02:
-			*cycles = 2
-			address = cpu.immediateAddress()
-		case 0x03:
-			*cycles = 6
-			address = cpu.absoluteAddress()
-		}
-	} else {
-		switch (opcode >> 2) & 0x03 {
-		case 0x00:
-			*cycles = 8
-			address = cpu.indirectIndexedAddress(cycles)
-		case 0x01:
-			*cycles = 6
-
-			switch opcode & 0xf0 {
-			case 0x90:
-				fallthrough
-			case 0xb0:
-				index = Y
-			default:
-				index = X
-			}
-
-			address = cpu.zeroPageIndexedAddress(index)
-		case 0x02:
-			*cycles = 7
-			address = cpu.absoluteIndexedAddress(Y, cycles)
-		case 0x03:
-			*cycles = 7
-
-			switch opcode & 0xf0 {
-			case 0x90:
-				fallthrough
-			case 0xb0:
-				index = Y
-			default:
-				index = X
-			}
-
-			address = cpu.absoluteIndexedAddress(index, cycles)
-		}
+	switch inst.mode {
+	case Immediate:
+		address = cpu.immediateAddress()
+	case ZeroPage:
+		address = cpu.zeroPageAddress()
+	case ZeroPageX:
+		address = cpu.zeroPageIndexedAddress(X)
+	case ZeroPageY:
+		address = cpu.zeroPageIndexedAddress(Y)
+	case Absolute:
+		address = cpu.absoluteAddress()
+	case AbsoluteX:
+		address = cpu.absoluteIndexedAddress(X, page)
+	case AbsoluteY:
+		address = cpu.absoluteIndexedAddress(Y, page)
+	case IndexedIndirect:
+		address = cpu.indexedIndirectAddress()
+	case IndirectIndexed:
+		address = cpu.indirectIndexedAddress(page)
 	}
 
 	return
 }
 
+// Returns the location of an immediate operand, which is stored in
+// the instruction stream directly after the opcode.  Unlike the other
+// addressing modes the returned address is not dereferenced to find
+// the operand, it is the operand's own location, so instructions can
+// treat every addressing mode uniformly by passing the returned
+// address to operand.
 func (cpu *M6502) immediateAddress() (result uint16) {
 	result = cpu.Registers.PC
 	cpu.Registers.PC++
@@ -591,14 +1512,13 @@ func (cpu *M6502) relativeAddress() (result uint16) {
 }
 
 func (cpu *M6502) absoluteAddress() (result uint16) {
-	low := cpu.Memory.Fetch(cpu.Registers.PC)
-	high := cpu.Memory.Fetch(cpu.Registers.PC + 1)
+	// PC+1 and PC+2 wrap around to the bottom of memory when the
+	// operand straddles 0xffff, just as they do on the 6502
+	result = Fetch16(cpu.Memory, cpu.Registers.PC)
 	cpu.Registers.PC += 2
 
-	result = (uint16(high) << 8) | uint16(low)
-
 	if cpu.decode.enabled {
-		cpu.decode.args = fmt.Sprintf("%02X %02X", low, high)
+		cpu.decode.args = fmt.Sprintf("%02X %02X", uint8(result), uint8(result>>8))
 		cpu.decode.decodedArgs = fmt.Sprintf("$%04X = ", result)
 	}
 
@@ -606,17 +1526,17 @@ func (cpu *M6502) absoluteAddress() (result uint16) {
 }
 
 func (cpu *M6502) indirectAddress() (result uint16) {
-	low := cpu.Memory.Fetch(cpu.Registers.PC)
-	high := cpu.Memory.Fetch(cpu.Registers.PC + 1)
+	pointer := Fetch16(cpu.Memory, cpu.Registers.PC)
+	low, high := uint8(pointer), uint8(pointer>>8)
 	cpu.Registers.PC += 2
 
 	if cpu.decode.enabled {
 		cpu.decode.args = fmt.Sprintf("%02X %02X", low, high)
 	}
 
-	// XXX: The 6502 had a bug in which it incremented only the
-	// high byte instead of the whole 16-bit address when
-	// computing the address.
+	// XXX: The NMOS 6502 had a bug in which it incremented only
+	// the low byte instead of the whole 16-bit address when
+	// computing the address.  The 65C02 fixed it.
 	//
 	// See http://www.obelisk.demon.co.uk/6502/reference.html#JMP
 	// and http://www.6502.org/tutorials/6502opcodes.html#JMP for
@@ -624,12 +1544,18 @@ func (cpu *M6502) indirectAddress() (result uint16) {
 	aHigh := (uint16(high) << 8) | uint16(low+1)
 	aLow := (uint16(high) << 8) | uint16(low)
 
+	if cpu.variant == CMOS65C02 {
+		aHigh = aLow + 1
+	}
+
 	low = cpu.Memory.Fetch(aLow)
 	high = cpu.Memory.Fetch(aHigh)
 
 	result = (uint16(high) << 8) | uint16(low)
 	badResult := (uint16(cpu.Memory.Fetch(aLow+1)) << 8) | uint16(low)
 
+	cpu.checkVector(aLow, result)
+
 	if cpu.decode.enabled {
 		cpu.decode.decodedArgs = fmt.Sprintf("($%04X) = %04X", aLow, badResult)
 	}
@@ -638,11 +1564,9 @@ func (cpu *M6502) indirectAddress() (result uint16) {
 }
 
 func (cpu *M6502) absoluteIndexedAddress(index Index, cycles *uint16) (result uint16) {
-	low := cpu.Memory.Fetch(cpu.Registers.PC)
-	high := cpu.Memory.Fetch(cpu.Registers.PC + 1)
+	address := Fetch16(cpu.Memory, cpu.Registers.PC)
 	cpu.Registers.PC += 2
 
-	address := (uint16(high) << 8) | uint16(low)
 	result = address + uint16(cpu.IndexToRegister(index))
 
 	if cycles != nil && !SamePage(address, result) {
@@ -650,13 +1574,19 @@ func (cpu *M6502) absoluteIndexedAddress(index Index, cycles *uint16) (result ui
 	}
 
 	if cpu.decode.enabled {
-		cpu.decode.args = fmt.Sprintf("%02X %02X", low, high)
+		cpu.decode.args = fmt.Sprintf("%02X %02X", uint8(address), uint8(address>>8))
 		cpu.decode.decodedArgs = fmt.Sprintf("$%04X,%s @ %04X = ", address, index.String(), result)
 	}
 
 	return
 }
 
+func (cpu *M6502) checkNullPointer(location uint8, pointer uint16) {
+	if cpu.nullTrap && pointer == 0x0000 {
+		cpu.fault = NullPointerError(location)
+	}
+}
+
 func (cpu *M6502) indexedIndirectAddress() (result uint16) {
 	value := cpu.Memory.Fetch(cpu.Registers.PC)
 	address := uint16(value + cpu.Registers.X)
@@ -666,6 +1596,7 @@ func (cpu *M6502) indexedIndirectAddress() (result uint16) {
 	high := cpu.Memory.Fetch((address + 1) & 0x00ff)
 
 	result = (uint16(high) << 8) | uint16(low)
+	cpu.checkNullPointer(uint8(address), result)
 
 	if cpu.decode.enabled {
 		cpu.decode.args = fmt.Sprintf("%02X", value)
@@ -684,6 +1615,7 @@ func (cpu *M6502) indirectIndexedAddress(cycles *uint16) (result uint16) {
 	high := cpu.Memory.Fetch((address + 1) & 0x00ff)
 
 	address = (uint16(high) << 8) | uint16(low)
+	cpu.checkNullPointer(value, address)
 
 	result = address + uint16(cpu.Registers.Y)
 
@@ -699,8 +1631,21 @@ func (cpu *M6502) indirectIndexedAddress(cycles *uint16) (result uint16) {
 	return
 }
 
+// Returns the value of the operand located at 'address', where
+// 'address' was returned by one of the addressing mode helpers.  For
+// the immediate addressing mode this is the operand byte itself, for
+// all other addressing modes it is the byte stored at the effective
+// address.
+func (cpu *M6502) operand(address uint16) uint8 {
+	if cpu.stackRead != nil && address>>8 == 0x01 && cpu.opcodeInfo(cpu.instOpCode).mode != Immediate {
+		cpu.stackRead(cpu.instPC, address)
+	}
+
+	return cpu.Memory.Fetch(address)
+}
+
 func (cpu *M6502) load(address uint16, register *uint8) {
-	value := cpu.setZNFlags(cpu.Memory.Fetch(address))
+	value := cpu.setZNFlags(cpu.operand(address))
 	*register = value
 
 	if cpu.decode.enabled {
@@ -740,8 +1685,8 @@ func (cpu *M6502) Lda(address uint16) {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of A is set
 func (cpu *M6502) Lax(address uint16) {
-	cpu.Registers.X = cpu.Memory.Fetch(address)
 	cpu.load(address, &cpu.Registers.A)
+	cpu.Registers.X = cpu.Registers.A
 }
 
 // Loads a byte of memory into the X register setting the zero and
@@ -829,6 +1774,19 @@ func (cpu *M6502) Sty(address uint16) {
 	cpu.store(address, cpu.Registers.Y)
 }
 
+// Stores zero into memory.  65C02 only.
+//
+//         C 	Carry Flag 	  Not affected
+//         Z 	Zero Flag 	  Not affected
+//         I 	Interrupt Disable Not affected
+//         D 	Decimal Mode Flag Not affected
+//         B 	Break Command 	  Not affected
+//         V 	Overflow Flag 	  Not affected
+//         N 	Negative Flag 	  Not affected
+func (cpu *M6502) Stz(address uint16) {
+	cpu.store(address, 0x00)
+}
+
 func (cpu *M6502) transfer(from uint8, to *uint8) {
 	*to = cpu.setZNFlags(from)
 }
@@ -917,8 +1875,25 @@ func (cpu *M6502) Txs() {
 	cpu.Registers.SP = cpu.Registers.X
 }
 
+// Returns the absolute address in the stack page (0x0100-0x01ff)
+// that the SP register currently points to.
+func (cpu *M6502) StackAddr() uint16 {
+	return 0x0100 | uint16(cpu.Registers.SP)
+}
+
+// Runs 'call', typically a function executing a subroutine on 'cpu',
+// and reports whether the SP register holds the same value afterwards.
+// 'delta' is the number of bytes left on the stack by 'call', which is
+// negative if it pulled more bytes than it pushed.
+func CheckStackBalance(cpu *M6502, call func()) (balanced bool, delta int) {
+	sp := cpu.Registers.SP
+	call()
+	delta = int(int8(sp - cpu.Registers.SP))
+	return delta == 0, delta
+}
+
 func (cpu *M6502) push(value uint8) {
-	cpu.Memory.Store(0x0100|uint16(cpu.Registers.SP), value)
+	cpu.Memory.Store(cpu.StackAddr(), value)
 	cpu.Registers.SP--
 }
 
@@ -929,7 +1904,7 @@ func (cpu *M6502) push16(value uint16) {
 
 func (cpu *M6502) pull() (value uint8) {
 	cpu.Registers.SP++
-	value = cpu.Memory.Fetch(0x0100 | uint16(cpu.Registers.SP))
+	value = cpu.Memory.Fetch(cpu.StackAddr())
 	return
 }
 
@@ -981,6 +1956,60 @@ func (cpu *M6502) Pla() {
 	cpu.Registers.A = cpu.setZNFlags(cpu.pull())
 }
 
+// Pushes a copy of the X register on to the stack.  65C02 only.
+//
+//         C 	Carry Flag 	  Not affected
+//         Z 	Zero Flag 	  Not affected
+//         I 	Interrupt Disable Not affected
+//         D 	Decimal Mode Flag Not affected
+//         B 	Break Command 	  Not affected
+//         V 	Overflow Flag 	  Not affected
+//         N 	Negative Flag 	  Not affected
+func (cpu *M6502) Phx() {
+	cpu.push(cpu.Registers.X)
+}
+
+// Pushes a copy of the Y register on to the stack.  65C02 only.
+//
+//         C 	Carry Flag 	  Not affected
+//         Z 	Zero Flag 	  Not affected
+//         I 	Interrupt Disable Not affected
+//         D 	Decimal Mode Flag Not affected
+//         B 	Break Command 	  Not affected
+//         V 	Overflow Flag 	  Not affected
+//         N 	Negative Flag 	  Not affected
+func (cpu *M6502) Phy() {
+	cpu.push(cpu.Registers.Y)
+}
+
+// Pulls an 8 bit value from the stack and into the X register. The
+// zero and negative flags are set as appropriate.  65C02 only.
+//
+//         C 	Carry Flag 	  Not affected
+//         Z 	Zero Flag 	  Set if X = 0
+//         I 	Interrupt Disable Not affected
+//         D 	Decimal Mode Flag Not affected
+//         B 	Break Command 	  Not affected
+//         V 	Overflow Flag 	  Not affected
+//         N 	Negative Flag 	  Set if bit 7 of X is set
+func (cpu *M6502) Plx() {
+	cpu.Registers.X = cpu.setZNFlags(cpu.pull())
+}
+
+// Pulls an 8 bit value from the stack and into the Y register. The
+// zero and negative flags are set as appropriate.  65C02 only.
+//
+//         C 	Carry Flag 	  Not affected
+//         Z 	Zero Flag 	  Set if Y = 0
+//         I 	Interrupt Disable Not affected
+//         D 	Decimal Mode Flag Not affected
+//         B 	Break Command 	  Not affected
+//         V 	Overflow Flag 	  Not affected
+//         N 	Negative Flag 	  Set if bit 7 of Y is set
+func (cpu *M6502) Ply() {
+	cpu.Registers.Y = cpu.setZNFlags(cpu.pull())
+}
+
 // Pulls an 8 bit value from the stack and into the processor
 // flags. The flags will take on new states as determined by the value
 // pulled.
@@ -989,13 +2018,22 @@ func (cpu *M6502) Pla() {
 //         Z 	Zero Flag 	  Set from stack
 //         I 	Interrupt Disable Set from stack
 //         D 	Decimal Mode Flag Set from stack
-//         B 	Break Command 	  Set from stack
+//         B 	Break Command 	  Cleared
 //         V 	Overflow Flag 	  Set from stack
 //         N 	Negative Flag 	  Set from stack
 func (cpu *M6502) Plp() {
-	cpu.Registers.P = Status(cpu.pull())
-	cpu.Registers.P &^= B
-	cpu.Registers.P |= U
+	cpu.pullP()
+}
+
+// Pulls the P register from the stack using Registers.SetP, keeping
+// the pulled bit 5 if unused bit forcing is disabled.
+func (cpu *M6502) pullP() {
+	value := cpu.pull()
+	cpu.Registers.SetP(value)
+
+	if cpu.rawUnused {
+		cpu.Registers.P = (cpu.Registers.P &^ U) | (Status(value) & U)
+	}
 }
 
 // A logical AND is performed, bit by bit, on the accumulator contents
@@ -1009,7 +2047,7 @@ func (cpu *M6502) Plp() {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 set
 func (cpu *M6502) And(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1034,7 +2072,7 @@ func (cpu *M6502) And(address uint16) {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 set
 func (cpu *M6502) Eor(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1059,7 +2097,7 @@ func (cpu *M6502) Eor(address uint16) {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 set
 func (cpu *M6502) Ora(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1087,7 +2125,7 @@ func (cpu *M6502) Ora(address uint16) {
 //         V 	Overflow Flag 	  Set to bit 6 of the memory value
 //         N 	Negative Flag 	  Set to bit 7 of the memory value
 func (cpu *M6502) Bit(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1103,27 +2141,73 @@ func (cpu *M6502) Bit(address uint16) {
 }
 
 func (cpu *M6502) addition(value uint16) {
+	if !cpu.decimalMode || cpu.Registers.P&D == 0 {
+		cpu.Registers.A = cpu.binaryAddition(value)
+		return
+	}
+
+	// NMOS decimal mode, which also handles invalid BCD digits as the
+	// 6502 does.  Z comes from the binary sum, while N and V come from
+	// the sum before the high digit is adjusted.
 	orig := uint16(cpu.Registers.A)
+	carry := uint16(cpu.CarryValue())
 
-	if !cpu.decimalMode || cpu.Registers.P&D == 0 {
-		result := cpu.setCFlagAddition(orig + value + uint16(cpu.Registers.P&C))
-		cpu.Registers.A = cpu.setZNFlags(uint8(cpu.setVFlagAddition(orig, value, result)))
-	} else {
-		low := uint16(orig&0x000f) + uint16(value&0x000f) + uint16(cpu.Registers.P&C)
-		high := uint16(orig&0x00f0) + uint16(value&0x00f0)
+	cpu.setZFlag(uint8(orig + value + carry))
 
-		if low >= 0x000a {
-			low -= 0x000a
-			high += 0x0010
-		}
+	low := orig&0x000f + value&0x000f + carry
 
-		if high >= 0x00a0 {
-			high -= 0x00a0
-		}
+	if low >= 0x000a {
+		low = ((low + 0x0006) & 0x000f) + 0x0010
+	}
+
+	result := orig&0x00f0 + value&0x00f0 + low
+
+	cpu.setNFlag(uint8(result))
+	cpu.setVFlagAddition(orig, value, result)
+
+	if result >= 0x00a0 {
+		result += 0x0060
+	}
+
+	cpu.Registers.P &^= C
+
+	if result >= 0x0100 {
+		cpu.Registers.P |= C
+	}
+
+	cpu.Registers.A = uint8(result)
+}
+
+// Adds 'value' and the carry bit to the accumulator in binary,
+// setting C, Z, V and N, and returns the result without storing it.
+func (cpu *M6502) binaryAddition(value uint16) uint8 {
+	orig := uint16(cpu.Registers.A)
+	result := cpu.setCFlagAddition(orig + value + uint16(cpu.CarryValue()))
+	return cpu.setZNFlags(uint8(cpu.setVFlagAddition(orig, value, result)))
+}
 
-		result := cpu.setCFlagAddition(high | (low & 0x000f))
-		cpu.Registers.A = cpu.setZNFlags(uint8(cpu.setVFlagAddition(orig, value, result)))
+// Subtracts 'value' and the borrow from the accumulator in NMOS
+// decimal mode.  All flags are set from the binary difference, as the
+// 6502 does, and invalid BCD digits are handled the same way.
+func (cpu *M6502) decimalSubtraction(value uint16) {
+	orig := int(cpu.Registers.A)
+	borrow := 1 - int(cpu.CarryValue())
+
+	cpu.binaryAddition(value ^ 0xff)
+
+	low := orig&0x0f - int(value&0x0f) - borrow
+
+	if low < 0 {
+		low = ((low - 0x06) & 0x0f) - 0x10
+	}
+
+	result := orig&0xf0 - int(value&0xf0) + low
+
+	if result < 0 {
+		result -= 0x60
 	}
+
+	cpu.Registers.A = uint8(result)
 }
 
 // This instruction adds the contents of a memory location to the
@@ -1139,7 +2223,7 @@ func (cpu *M6502) addition(value uint16) {
 //         V 	Overflow Flag 	  Set if sign bit is incorrect
 //         N 	Negative Flag 	  Set if bit 7 set
 func (cpu *M6502) Adc(address uint16) {
-	value := uint16(cpu.Memory.Fetch(address))
+	value := uint16(cpu.operand(address))
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1166,7 +2250,7 @@ func (cpu *M6502) Adc(address uint16) {
 //         V 	Overflow Flag 	  Set if sign bit is incorrect
 //         N 	Negative Flag 	  Set if bit 7 set
 func (cpu *M6502) Sbc(address uint16) {
-	value := uint16(cpu.Memory.Fetch(address))
+	value := uint16(cpu.operand(address))
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1177,13 +2261,11 @@ func (cpu *M6502) Sbc(address uint16) {
 		cpu.decode.decodedArgs += fmt.Sprintf("%02X", value)
 	}
 
-	if cpu.Registers.P&D == 0 {
-		value ^= 0xff
+	if !cpu.decimalMode || cpu.Registers.P&D == 0 {
+		cpu.Registers.A = cpu.binaryAddition(value ^ 0xff)
 	} else {
-		value = 0x99 - value
+		cpu.decimalSubtraction(value)
 	}
-
-	cpu.addition(value)
 }
 
 func (cpu *M6502) compare(value uint16, register uint8) {
@@ -1202,7 +2284,7 @@ func (cpu *M6502) compare(value uint16, register uint8) {
 
 // Unofficial
 func (cpu *M6502) Dcp(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1222,7 +2304,7 @@ func (cpu *M6502) Dcp(address uint16) {
 
 // Unofficial
 func (cpu *M6502) Isb(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1242,7 +2324,7 @@ func (cpu *M6502) Isb(address uint16) {
 
 // Unofficial
 func (cpu *M6502) Slo(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1262,7 +2344,7 @@ func (cpu *M6502) Slo(address uint16) {
 
 // Unofficial
 func (cpu *M6502) Rla(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1282,7 +2364,7 @@ func (cpu *M6502) Rla(address uint16) {
 
 // Unofficial
 func (cpu *M6502) Sre(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1302,7 +2384,7 @@ func (cpu *M6502) Sre(address uint16) {
 
 // Unofficial
 func (cpu *M6502) Rra(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1332,7 +2414,7 @@ func (cpu *M6502) Rra(address uint16) {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of the result is set
 func (cpu *M6502) Cmp(address uint16) {
-	value := uint16(cpu.Memory.Fetch(address))
+	value := uint16(cpu.operand(address))
 	cpu.compare(value, cpu.Registers.A)
 }
 
@@ -1348,7 +2430,7 @@ func (cpu *M6502) Cmp(address uint16) {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of the result is set
 func (cpu *M6502) Cpx(address uint16) {
-	value := uint16(cpu.Memory.Fetch(address))
+	value := uint16(cpu.operand(address))
 	cpu.compare(value, cpu.Registers.X)
 }
 
@@ -1364,7 +2446,7 @@ func (cpu *M6502) Cpx(address uint16) {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of the result is set
 func (cpu *M6502) Cpy(address uint16) {
-	value := uint16(cpu.Memory.Fetch(address))
+	value := uint16(cpu.operand(address))
 	cpu.compare(value, cpu.Registers.Y)
 }
 
@@ -1379,7 +2461,7 @@ func (cpu *M6502) Cpy(address uint16) {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of the result is set
 func (cpu *M6502) Inc(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1436,7 +2518,7 @@ func (cpu *M6502) Iny() {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of the result is set
 func (cpu *M6502) Dec(address uint16) {
-	value := cpu.Memory.Fetch(address)
+	value := cpu.operand(address)
 
 	if cpu.decode.enabled {
 		if !strings.HasPrefix(cpu.decode.decodedArgs, "#") &&
@@ -1551,7 +2633,7 @@ func (cpu *M6502) AslA() {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of the result is set
 func (cpu *M6502) Asl(address uint16) {
-	cpu.shift(left, cpu.Memory.Fetch(address), func(value uint8) { cpu.Memory.Store(address, value) })
+	cpu.shift(left, cpu.operand(address), func(value uint8) { cpu.Memory.Store(address, value) })
 }
 
 // Each of the bits in A is shift one place to the right. The bit that
@@ -1583,7 +2665,7 @@ func (cpu *M6502) LsrA() {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of the result is set
 func (cpu *M6502) Lsr(address uint16) {
-	cpu.shift(right, cpu.Memory.Fetch(address), func(value uint8) { cpu.Memory.Store(address, value) })
+	cpu.shift(right, cpu.operand(address), func(value uint8) { cpu.Memory.Store(address, value) })
 }
 
 func (cpu *M6502) rotate(direction direction, value uint8, store func(uint8)) {
@@ -1601,10 +2683,10 @@ func (cpu *M6502) rotate(direction direction, value uint8, store func(uint8)) {
 	switch direction {
 	case left:
 		c = Status(value & uint8(N) >> 7)
-		value = ((value << 1) & uint8(^C)) | uint8(cpu.Registers.P&C)
+		value = (value << 1) | cpu.CarryValue()
 	case right:
 		c = Status(value & uint8(C))
-		value = ((value >> 1) & uint8(^N)) | uint8((cpu.Registers.P&C)<<7)
+		value = (value >> 1) | (cpu.CarryValue() << 7)
 	}
 
 	cpu.Registers.P &= ^C
@@ -1644,7 +2726,7 @@ func (cpu *M6502) RolA() {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of the result is set
 func (cpu *M6502) Rol(address uint16) {
-	cpu.rotate(left, cpu.Memory.Fetch(address), func(value uint8) { cpu.Memory.Store(address, value) })
+	cpu.rotate(left, cpu.operand(address), func(value uint8) { cpu.Memory.Store(address, value) })
 }
 
 // Move each of the bits in A one place to the right. Bit 7 is filled
@@ -1678,7 +2760,7 @@ func (cpu *M6502) RorA() {
 //         V 	Overflow Flag 	  Not affected
 //         N 	Negative Flag 	  Set if bit 7 of the result is set
 func (cpu *M6502) Ror(address uint16) {
-	cpu.rotate(right, cpu.Memory.Fetch(address), func(value uint8) { cpu.Memory.Store(address, value) })
+	cpu.rotate(right, cpu.operand(address), func(value uint8) { cpu.Memory.Store(address, value) })
 }
 
 // Sets the program counter to the address specified by the operand.
@@ -1745,6 +2827,8 @@ func (cpu *M6502) branch(address uint16, condition func() bool, cycles *uint16)
 
 		if !SamePage(cpu.Registers.PC, address) {
 			*cycles++
+		} else if cpu.branchDelay {
+			cpu.delayPoll = true
 		}
 
 		cpu.Registers.PC = address
@@ -1863,6 +2947,20 @@ func (cpu *M6502) Bvs(address uint16, cycles *uint16) {
 	cpu.branch(address, func() bool { return cpu.Registers.P&V != 0 }, cycles)
 }
 
+// Adds the relative displacement to the program counter to cause a
+// branch to a new location, unconditionally.  65C02 only.
+//
+//         C 	Carry Flag 	  Not affected
+//         Z 	Zero Flag 	  Not affected
+//         I 	Interrupt Disable Not affected
+//         D 	Decimal Mode Flag Not affected
+//         B 	Break Command 	  Not affected
+//         V 	Overflow Flag 	  Not affected
+//         N 	Negative Flag 	  Not affected
+func (cpu *M6502) Bra(address uint16, cycles *uint16) {
+	cpu.branch(address, func() bool { return true }, cycles)
+}
+
 // Set the carry flag to zero.
 //
 //         C 	Carry Flag 	  Set to 0
@@ -1941,6 +3039,10 @@ func (cpu *M6502) Sec() {
 //         N 	Negative Flag 	  Not affected
 func (cpu *M6502) Sed() {
 	cpu.Registers.P |= D
+
+	if cpu.decimalUse != nil && !cpu.decimalMode {
+		cpu.decimalUse(cpu.instPC)
+	}
 }
 
 // Set the interrupt disable flag to one.
@@ -1972,14 +3074,12 @@ func (cpu *M6502) Brk() {
 	cpu.Registers.PC++
 
 	cpu.push16(cpu.Registers.PC)
-	cpu.push(uint8(cpu.Registers.P | B))
+	cpu.push(uint8(cpu.Registers.P | B | U))
 
 	cpu.Registers.P |= I
+	cpu.clearDecimalOnInterrupt()
 
-	low := cpu.Memory.Fetch(0xfffe)
-	high := cpu.Memory.Fetch(0xffff)
-
-	cpu.Registers.PC = (uint16(high) << 8) | uint16(low)
+	cpu.Registers.PC = cpu.vector(0xfffe)
 }
 
 // The NOP instruction causes no changes to the processor other than
@@ -2030,10 +3130,10 @@ func (cpu *M6502) NopAddress(address uint16) {
 //         Z 	Zero Flag 	  Set from stack
 //         I 	Interrupt Disable Set from stack
 //         D 	Decimal Mode Flag Set from stack
-//         B 	Break Command 	  Set from stack
+//         B 	Break Command 	  Cleared
 //         V 	Overflow Flag 	  Set from stack
 //         N 	Negative Flag 	  Set from stack
 func (cpu *M6502) Rti() {
-	cpu.Registers.P = Status(cpu.pull()) | U
+	cpu.pullP()
 	cpu.Registers.PC = cpu.pull16()
 }
@@ -0,0 +1,1866 @@
+package m65go2
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// loadCountdown stores a small program at 0x0100 which counts X down
+// from 0xff to 0x00 and then hits an illegal opcode.
+func loadCountdown(cpu *M6502) {
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa2) // LDX #$ff
+	cpu.Memory.Store(0x0101, 0xff)
+	cpu.Memory.Store(0x0102, 0xca) // DEX
+	cpu.Memory.Store(0x0103, 0xd0) // BNE $0102
+	cpu.Memory.Store(0x0104, 0xfd)
+	cpu.Memory.Store(0x0105, 0x02) // illegal opcode
+}
+
+// CycleCounting
+
+func TestDisableCycleCounting(t *testing.T) {
+	Setup()
+
+	cpu.Cycles = make(chan uint16)
+	cpu.DisableCycleCounting()
+	cpu.SetCycleBreakpoint(1)
+
+	loadCountdown(cpu)
+
+	total, err := cpu.RunCount()
+
+	if _, ok := err.(BadOpCodeError); !ok {
+		t.Error("Did not receive expected error type BadOpCodeError")
+	}
+
+	if cpu.Registers.X != 0x00 {
+		t.Error("Register X is not 0x00")
+	}
+
+	if total != 0 {
+		t.Errorf("RunCount returned %d cycles, not 0\n", total)
+	}
+
+	if cpu.CycleCount() != 0 {
+		t.Errorf("CycleCount is %d, not 0\n", cpu.CycleCount())
+	}
+
+	cpu.EnableCycleCounting()
+	cpu.SetCycleBreakpoint(0)
+
+	loadCountdown(cpu)
+	cpu.Cycles = nil
+
+	total, _ = cpu.RunCount()
+
+	if total == 0 || cpu.CycleCount() != total {
+		t.Errorf("CycleCount is %d, not RunCount's %d\n", cpu.CycleCount(), total)
+	}
+
+	Teardown()
+}
+
+func BenchmarkRunWithCycleCounting(b *testing.B) {
+	cycles := make(chan uint16)
+	cpu := NewM6502(NewBasicMemory(DEFAULT_MEMORY_SIZE), cycles)
+
+	done := make(chan bool)
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-cycles:
+				cycles <- 0
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < b.N; i++ {
+		loadCountdown(cpu)
+		cpu.Run()
+	}
+}
+
+func BenchmarkRunWithoutCycleCounting(b *testing.B) {
+	cpu := NewM6502(NewBasicMemory(DEFAULT_MEMORY_SIZE), make(chan uint16))
+	cpu.DisableCycleCounting()
+
+	for i := 0; i < b.N; i++ {
+		loadCountdown(cpu)
+		cpu.Run()
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	cpu := NewM6502(NewBasicMemory(DEFAULT_MEMORY_SIZE), nil)
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9) // LDA #$01
+	cpu.Memory.Store(0x0101, 0x01)
+	cpu.Memory.Store(0x0102, 0x69) // ADC #$01
+	cpu.Memory.Store(0x0103, 0x01)
+	cpu.Memory.Store(0x0104, 0x4c) // JMP $0100
+	cpu.Memory.Store(0x0105, 0x00)
+	cpu.Memory.Store(0x0106, 0x01)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		cpu.Execute()
+	}
+}
+
+// Registers.String
+
+func TestRegistersString(t *testing.T) {
+	reg := Registers{A: 0x12, X: 0x34, Y: 0x56, P: N | U | I | C, SP: 0xfd, PC: 0xc000}
+
+	var stringer fmt.Stringer = reg
+
+	expected := "A:12 X:34 Y:56 P:A5 SP:FD PC:C000 Nv-bdIzC"
+
+	if stringer.String() != expected {
+		t.Errorf("String is %q, not %q\n", stringer.String(), expected)
+	}
+
+	if (N | V | U | B | D | I | Z | C).String() != "NV-BDIZC" {
+		t.Error("Status string is not NV-BDIZC")
+	}
+
+	if Status(0).String() != "nv-bdizc" {
+		t.Error("Status string is not nv-bdizc")
+	}
+}
+
+// StackAddr
+
+func TestStackAddr(t *testing.T) {
+	Setup()
+
+	for sp, addr := range map[uint8]uint16{0x00: 0x0100, 0xfd: 0x01fd, 0xff: 0x01ff} {
+		cpu.Registers.SP = sp
+
+		if cpu.StackAddr() != addr {
+			t.Errorf("StackAddr is not %#04x for SP %#02x\n", addr, sp)
+		}
+	}
+
+	Teardown()
+}
+
+// OnFlagChange
+
+func TestOnFlagChange(t *testing.T) {
+	Setup()
+
+	var calls int
+	var before, after Status
+
+	cpu.OnFlagChange(func(old, new Status) {
+		calls++
+		before, after = old, new
+	})
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9) // LDA #$00
+	cpu.Memory.Store(0x0101, 0x00)
+	cpu.Memory.Store(0x0102, 0xa9) // LDA #$00
+	cpu.Memory.Store(0x0103, 0x00)
+
+	cpu.Execute()
+
+	if calls != 1 {
+		t.Error("Callback was not called once")
+	}
+
+	if before&Z != 0 {
+		t.Error("Old Z flag is set")
+	}
+
+	if after&Z == 0 {
+		t.Error("New Z flag is not set")
+	}
+
+	if after^before != Z {
+		t.Error("Flags other than Z changed")
+	}
+
+	cpu.Execute()
+
+	if calls != 1 {
+		t.Error("Callback was called although P did not change")
+	}
+
+	Teardown()
+}
+
+// ExecuteOpcode
+
+func TestExecuteOpcode(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0101
+
+	cpu.Memory.Store(0x0101, 0xff)
+
+	cycles, err := cpu.ExecuteOpcode(0xa9)
+
+	if err != nil {
+		t.Error("Error during ExecuteOpcode")
+	}
+
+	if cycles != 2 {
+		t.Error("Cycles is not 2")
+	}
+
+	if cpu.Registers.A != 0xff {
+		t.Error("Register A is not 0xff")
+	}
+
+	if cpu.Registers.PC != 0x0102 {
+		t.Error("Register PC is not 0x0102")
+	}
+
+	if _, err := cpu.ExecuteOpcode(0x02); err == nil {
+		t.Error("No error returned")
+	} else if _, ok := err.(BadOpCodeError); !ok {
+		t.Error("Did not receive expected error type BadOpCodeError")
+	}
+
+	Teardown()
+}
+
+// Unused bit
+
+func TestUnusedBitForcing(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+	cpu.push(0x00)
+
+	cpu.Memory.Store(0x0100, 0x28) // PLP
+
+	cpu.Execute()
+
+	if cpu.Registers.P&U == 0 {
+		t.Error("U flag is not set after PLP")
+	}
+
+	cpu.Registers.P = 0x00
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xea) // NOP
+
+	cpu.Execute()
+
+	if cpu.Registers.P != U {
+		t.Error("Status is not 0x20 after direct assignment")
+	}
+
+	Teardown()
+}
+
+func TestDisableUnusedBitForcing(t *testing.T) {
+	Setup()
+
+	cpu.DisableUnusedBitForcing()
+
+	cpu.Registers.PC = 0x0100
+	cpu.push(0x00)
+
+	cpu.Memory.Store(0x0100, 0x28) // PLP
+
+	cpu.Execute()
+
+	if cpu.Registers.P&U != 0 {
+		t.Error("U flag is set after PLP")
+	}
+
+	Teardown()
+}
+
+// StepTrace
+
+func TestStepTrace(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9) // LDA #$80
+	cpu.Memory.Store(0x0101, 0x80)
+
+	var buf bytes.Buffer
+
+	result, err := cpu.StepTrace(&buf)
+
+	if err != nil {
+		t.Error("Error during StepTrace")
+	}
+
+	expected := "0100  A9 80     LDA #$80                        A:00 X:00 Y:00 P:24 SP:FD\n"
+
+	if buf.String() != expected {
+		t.Errorf("Trace line is %q, not %q\n", buf.String(), expected)
+	}
+
+	if result.PC != 0x0100 {
+		t.Error("Result PC is not 0x0100")
+	}
+
+	if result.OpCode != 0xa9 {
+		t.Error("Result OpCode is not 0xa9")
+	}
+
+	if result.Cycles != 2 {
+		t.Error("Result Cycles is not 2")
+	}
+
+	if result.Registers.A != 0x80 || result.Registers.PC != 0x0102 {
+		t.Error("Result Registers do not reflect the executed instruction")
+	}
+
+	cpu.Memory.Store(0x0102, 0xea) // NOP
+
+	cpu.Execute()
+
+	if buf.String() != expected {
+		t.Error("Trace line written after StepTrace returned")
+	}
+
+	Teardown()
+}
+
+// RunCount
+
+func TestRunCount(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9) // LDA #$01
+	cpu.Memory.Store(0x0101, 0x01)
+	cpu.Memory.Store(0x0102, 0x85) // STA $10
+	cpu.Memory.Store(0x0103, 0x10)
+	cpu.Memory.Store(0x0104, 0xea) // NOP
+	cpu.Memory.Store(0x0105, 0x02) // illegal opcode
+
+	cycles, err := cpu.RunCount()
+
+	if _, ok := err.(BadOpCodeError); !ok {
+		t.Error("Did not receive expected error type BadOpCodeError")
+	}
+
+	if cycles != 7 {
+		t.Errorf("Cycles is %d, not 7\n", cycles)
+	}
+
+	Teardown()
+
+	Setup()
+
+	loadCountdown(cpu)
+
+	cycles, _ = cpu.RunCount()
+
+	// LDX + 255 * DEX + 254 * taken BNE + untaken BNE
+	if cycles != 2+255*2+254*3+2 {
+		t.Errorf("Cycles is %d, not %d\n", cycles, 2+255*2+254*3+2)
+	}
+
+	Teardown()
+}
+
+// SetPostExecHook
+
+func TestSetPostExecHook(t *testing.T) {
+	Setup()
+
+	var total uint64
+	var calls int
+
+	cpu.SetPostExecHook(func(cpu *M6502, cycles uint16) {
+		total += uint64(cycles)
+		calls++
+	})
+
+	loadCountdown(cpu)
+
+	cycles, _ := cpu.RunCount()
+
+	if total != cycles {
+		t.Errorf("Hook total is %d, not %d\n", total, cycles)
+	}
+
+	// LDX + 255 * (DEX + BNE)
+	if calls != 1+255*2 {
+		t.Errorf("Hook was called %d times, not %d\n", calls, 1+255*2)
+	}
+
+	Teardown()
+}
+
+// Branch interrupt delay
+
+func runBranchIrq(cpu *M6502) (pcs []uint16) {
+	cpu.Registers.P = 0x00
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x90) // BCC $0102
+	cpu.Memory.Store(0x0101, 0x00)
+	cpu.Memory.Store(0x0102, 0xea) // NOP
+	cpu.Memory.Store(0x0200, 0xea) // NOP
+	cpu.Memory.Store(0xfffe, 0x00)
+	cpu.Memory.Store(0xffff, 0x02)
+
+	var total uint64
+
+	// raise IRQ on cycle 3, the last cycle of the taken branch
+	cpu.SetPostExecHook(func(cpu *M6502, cycles uint16) {
+		total += uint64(cycles)
+
+		if total == 3 {
+			cpu.Interrupt(Irq, true)
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		result, _ := cpu.step()
+		pcs = append(pcs, result.PC)
+	}
+
+	return
+}
+
+func TestBranchInterruptDelay(t *testing.T) {
+	Setup()
+
+	pcs := runBranchIrq(cpu)
+
+	if pcs[1] != 0x0200 {
+		t.Errorf("IRQ was not serviced after the branch, executed %#04x\n", pcs[1])
+	}
+
+	Teardown()
+
+	Setup()
+
+	cpu.EnableBranchInterruptDelay()
+
+	pcs = runBranchIrq(cpu)
+
+	if pcs[1] != 0x0102 {
+		t.Errorf("IRQ was not delayed by the branch, executed %#04x\n", pcs[1])
+	}
+
+	if pcs[2] != 0x0200 {
+		t.Errorf("IRQ was not serviced after the delay, executed %#04x\n", pcs[2])
+	}
+
+	Teardown()
+}
+
+// Null pointer trap
+
+func TestNullPointerTrap(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xb1) // LDA ($84),Y
+	cpu.Memory.Store(0x0101, 0x84)
+
+	if _, err := cpu.Execute(); err != nil {
+		t.Error("Error returned with the null pointer trap disabled")
+	}
+
+	cpu.EnableNullPointerTrap()
+
+	cpu.Registers.PC = 0x0100
+
+	_, err := cpu.Execute()
+
+	if e, ok := err.(NullPointerError); !ok {
+		t.Error("Did not receive expected error type NullPointerError")
+	} else if e != 0x84 {
+		t.Error("NullPointerError is not 0x84")
+	}
+
+	cpu.Memory.Store(0x0085, 0x02)
+
+	cpu.Registers.PC = 0x0100
+
+	if _, err := cpu.Execute(); err != nil {
+		t.Error("Error returned for a non-null pointer")
+	}
+
+	Teardown()
+}
+
+// SetPC
+
+func TestSetPC(t *testing.T) {
+	Setup()
+
+	cpu.SetPC(0x0600)
+
+	if cpu.Registers.PC != 0x0600 {
+		t.Error("Register PC is not 0x0600")
+	}
+
+	cpu.Memory.Store(0x0600, 0xa9) // LDA #$2a
+	cpu.Memory.Store(0x0601, 0x2a)
+	cpu.Memory.Store(0x0602, 0xe8) // INX
+	cpu.Memory.Store(0x0603, 0x00) // BRK
+
+	err := cpu.Run()
+
+	if _, ok := err.(BrkOpCodeError); !ok {
+		t.Error("Did not receive expected error type BrkOpCodeError")
+	}
+
+	if cpu.Registers.A != 0x2a {
+		t.Error("Register A is not 0x2a")
+	}
+
+	if cpu.Registers.X != 0x01 {
+		t.Error("Register X is not 0x01")
+	}
+
+	Teardown()
+}
+
+// MeasureSpeed
+
+func TestMeasureSpeed(t *testing.T) {
+	Setup()
+
+	cpu.Memory.Store(0x0100, 0xe8) // INX
+	cpu.Memory.Store(0x0101, 0x4c) // JMP $0100
+	cpu.Memory.Store(0x0102, 0x00)
+	cpu.Memory.Store(0x0103, 0x01)
+
+	cpu.SetPC(0x0100)
+
+	d := 50 * time.Millisecond
+	start := time.Now()
+
+	mhz, err := cpu.MeasureSpeed(d)
+
+	if err != nil {
+		t.Errorf("Error during MeasureSpeed: %s\n", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < d {
+		t.Errorf("MeasureSpeed ran for %s, not at least %s\n", elapsed, d)
+	}
+
+	if mhz <= 0 {
+		t.Errorf("MeasureSpeed reported %f MHz\n", mhz)
+	}
+
+	Teardown()
+}
+
+// SetCycleBreakpoint
+
+func TestSetCycleBreakpoint(t *testing.T) {
+	breakpoints := map[uint64]uint16{
+		4: 0x0102,
+		5: 0x0104,
+		6: 0x0104,
+	}
+
+	for breakpoint, pc := range breakpoints {
+		Setup()
+
+		cpu.Registers.PC = 0x0100
+
+		cpu.Memory.Store(0x0100, 0xa9) // LDA #$01
+		cpu.Memory.Store(0x0101, 0x01)
+		cpu.Memory.Store(0x0102, 0x85) // STA $10
+		cpu.Memory.Store(0x0103, 0x10)
+		cpu.Memory.Store(0x0104, 0xea) // NOP
+		cpu.Memory.Store(0x0105, 0x02) // illegal opcode
+
+		cpu.SetCycleBreakpoint(breakpoint)
+
+		cycles, err := cpu.RunCount()
+
+		if _, ok := err.(CycleBreakpointError); !ok {
+			t.Error("Did not receive expected error type CycleBreakpointError")
+		}
+
+		if cpu.Registers.PC != pc {
+			t.Errorf("Breakpoint %d: register PC is %#04x, not %#04x\n", breakpoint, cpu.Registers.PC, pc)
+		}
+
+		if cycles > breakpoint {
+			t.Errorf("Breakpoint %d: ran for %d cycles\n", breakpoint, cycles)
+		}
+
+		if _, err := cpu.RunCount(); err != CycleBreakpointError(cpu.CycleCount()) {
+			t.Errorf("Breakpoint %d: resumed run did not stop again\n", breakpoint)
+		}
+
+		cpu.SetCycleBreakpoint(0)
+
+		if _, err := cpu.RunCount(); err == nil {
+			t.Error("Run did not stop at the illegal opcode")
+		} else if _, ok := err.(BadOpCodeError); !ok {
+			t.Error("Did not receive expected error type BadOpCodeError")
+		}
+
+		Teardown()
+	}
+}
+
+func TestCycleBreakpointCumulative(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9) // LDA #$01
+	cpu.Memory.Store(0x0101, 0x01)
+	cpu.Memory.Store(0x0102, 0x85) // STA $10
+	cpu.Memory.Store(0x0103, 0x10)
+	cpu.Memory.Store(0x0104, 0xea) // NOP
+	cpu.Memory.Store(0x0105, 0x02) // illegal opcode
+
+	cpu.Execute()
+
+	if cpu.CycleCount() != 2 {
+		t.Errorf("CycleCount is %d, not 2\n", cpu.CycleCount())
+	}
+
+	// STA would take the count from 2 to 5
+	cpu.SetCycleBreakpoint(4)
+
+	if _, err := cpu.RunCount(); err != CycleBreakpointError(2) {
+		t.Error("Did not receive expected error CycleBreakpointError(2)")
+	}
+
+	if cpu.Registers.PC != 0x0102 {
+		t.Error("Register PC is not 0x0102")
+	}
+
+	// servicing the pending IRQ takes 7 cycles before STA's 3
+	cpu.Registers.P &^= I
+	cpu.Irq = true
+
+	cpu.Memory.Store(0xfffe, 0x02)
+	cpu.Memory.Store(0xffff, 0x01)
+
+	cpu.SetCycleBreakpoint(11)
+
+	if _, err := cpu.RunCount(); err != CycleBreakpointError(2) {
+		t.Error("Did not receive expected error CycleBreakpointError(2)")
+	}
+
+	cpu.SetCycleBreakpoint(12)
+
+	if _, err := cpu.RunCount(); err != CycleBreakpointError(12) {
+		t.Error("Did not receive expected error CycleBreakpointError(12)")
+	}
+
+	if cpu.Registers.PC != 0x0104 {
+		t.Error("Register PC is not 0x0104")
+	}
+
+	Teardown()
+}
+
+func TestCycleCountExecuteOpcode(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0101
+
+	cpu.Memory.Store(0x0101, 0x01) // operand of LDA #$01
+	cpu.Memory.Store(0x0102, 0xea) // NOP
+	cpu.Memory.Store(0x0103, 0xea) // NOP
+	cpu.Memory.Store(0x0104, 0x02) // illegal opcode
+
+	cpu.ExecuteOpcode(0xa9)
+
+	if cpu.CycleCount() != 2 {
+		t.Errorf("CycleCount is %d, not 2\n", cpu.CycleCount())
+	}
+
+	// the second NOP would take the count from 4 to 6
+	cpu.SetCycleBreakpoint(5)
+
+	if _, err := cpu.RunCount(); err != CycleBreakpointError(4) {
+		t.Error("Did not receive expected error CycleBreakpointError(4)")
+	}
+
+	if cpu.Registers.PC != 0x0103 {
+		t.Error("Register PC is not 0x0103")
+	}
+
+	Teardown()
+}
+
+// SetP/GetP
+
+func TestSetP(t *testing.T) {
+	Setup()
+
+	cpu.Registers.SetP(0xff)
+
+	if cpu.Registers.GetP() != 0xef {
+		t.Error("Status is not 0xef")
+	}
+
+	cpu.Registers.SetP(0x00)
+
+	if cpu.Registers.GetP() != 0x20 {
+		t.Error("Status is not 0x20")
+	}
+
+	cpu.Registers.PC = 0x0100
+	cpu.push(0x10)
+
+	cpu.Memory.Store(0x0100, 0x28) // PLP
+
+	cpu.Execute()
+
+	if cpu.Registers.GetP() != 0x20 {
+		t.Error("Status is not 0x20 after PLP")
+	}
+
+	cpu.Registers.PC = 0x0100
+	cpu.push16(0x0102)
+	cpu.push(0xd3)
+
+	cpu.Memory.Store(0x0100, 0x40) // RTI
+
+	cpu.Execute()
+
+	if cpu.Registers.GetP() != 0xe3 {
+		t.Error("Status is not 0xe3 after RTI")
+	}
+
+	Teardown()
+}
+
+// Stack data reads
+
+func TestOnStackDataRead(t *testing.T) {
+	Setup()
+
+	var pcs, addresses []uint16
+
+	cpu.OnStackDataRead(func(pc uint16, address uint16) {
+		pcs = append(pcs, pc)
+		addresses = append(addresses, address)
+	})
+
+	cpu.Registers.PC = 0x0200
+	cpu.push(0x42)
+
+	cpu.Memory.Store(0x0200, 0x68) // PLA
+	cpu.Memory.Store(0x0201, 0xa9) // LDA #$01
+	cpu.Memory.Store(0x0202, 0x01)
+	cpu.Memory.Store(0x0203, 0xad) // LDA $01f0
+	cpu.Memory.Store(0x0204, 0xf0)
+	cpu.Memory.Store(0x0205, 0x01)
+
+	cpu.Execute()
+
+	if len(pcs) != 0 {
+		t.Error("Stack data read reported for PLA")
+	}
+
+	cpu.Execute()
+	cpu.Execute()
+
+	if len(pcs) != 1 {
+		t.Fatalf("%d stack data reads reported, not 1\n", len(pcs))
+	}
+
+	if pcs[0] != 0x0203 {
+		t.Error("Stack data read PC is not 0x0203")
+	}
+
+	if addresses[0] != 0x01f0 {
+		t.Error("Stack data read address is not 0x01f0")
+	}
+
+	// immediate operands are not reported even when the instruction
+	// itself is in the stack page, and LAX reads its operand once
+	pcs = nil
+
+	cpu.EnableIllegalOpcodes()
+
+	cpu.Registers.PC = 0x0180
+
+	cpu.Memory.Store(0x0180, 0xa9) // LDA #$01
+	cpu.Memory.Store(0x0181, 0x01)
+	cpu.Memory.Store(0x0182, 0xaf) // LAX $01f0
+	cpu.Memory.Store(0x0183, 0xf0)
+	cpu.Memory.Store(0x0184, 0x01)
+
+	cpu.Execute()
+
+	if len(pcs) != 0 {
+		t.Error("Stack data read reported for an immediate operand")
+	}
+
+	cpu.Execute()
+
+	if len(pcs) != 1 {
+		t.Fatalf("%d stack data reads reported for LAX, not 1\n", len(pcs))
+	}
+
+	if pcs[0] != 0x0182 {
+		t.Error("Stack data read PC is not 0x0182")
+	}
+
+	Teardown()
+}
+
+// CarryValue
+
+func TestCarryValue(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x38) // SEC
+	cpu.Memory.Store(0x0101, 0x18) // CLC
+
+	cpu.Execute()
+
+	if cpu.CarryValue() != 1 {
+		t.Error("CarryValue is not 1 after SEC")
+	}
+
+	cpu.Execute()
+
+	if cpu.CarryValue() != 0 {
+		t.Error("CarryValue is not 0 after CLC")
+	}
+
+	Teardown()
+}
+
+// Trace
+
+func TestTrace(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa2) // LDX #$02
+	cpu.Memory.Store(0x0101, 0x02)
+	cpu.Memory.Store(0x0102, 0xca) // DEX
+	cpu.Memory.Store(0x0103, 0xd0) // BNE $0102
+	cpu.Memory.Store(0x0104, 0xfd)
+	cpu.Memory.Store(0x0105, 0x02) // illegal opcode
+
+	results, err := cpu.Trace(10)
+
+	if _, ok := err.(BadOpCodeError); !ok {
+		t.Error("Did not receive expected error type BadOpCodeError")
+	}
+
+	pcs := []uint16{0x0100, 0x0102, 0x0103, 0x0102, 0x0103, 0x0105}
+
+	if len(results) != len(pcs) {
+		t.Fatalf("%d results returned, not %d\n", len(results), len(pcs))
+	}
+
+	for i, pc := range pcs {
+		if results[i].PC != pc {
+			t.Errorf("Result %d: PC is %#04x, not %#04x\n", i, results[i].PC, pc)
+		}
+	}
+
+	if results[2].Cycles != 3 || results[4].Cycles != 2 {
+		t.Error("Taken and untaken BNE cycles are not 3 and 2")
+	}
+
+	if results[3].Registers.X != 0x00 {
+		t.Error("Register X is not 0x00 after the second DEX")
+	}
+
+	Teardown()
+
+	Setup()
+
+	loadCountdown(cpu)
+
+	results, err = cpu.Trace(3)
+
+	if err != nil || len(results) != 3 {
+		t.Error("Trace did not stop after 3 instructions")
+	}
+
+	Teardown()
+}
+
+// Decimal mode use
+
+func TestOnDecimalModeUse(t *testing.T) {
+	Setup()
+
+	var pcs []uint16
+
+	cpu.OnDecimalModeUse(func(pc uint16) {
+		pcs = append(pcs, pc)
+	})
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xf8) // SED
+
+	cpu.Execute()
+
+	if len(pcs) != 0 {
+		t.Error("Callback fired with decimal mode enabled")
+	}
+
+	cpu.DisableDecimalMode()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Execute()
+
+	if len(pcs) != 1 || pcs[0] != 0x0100 {
+		t.Error("Callback did not fire for SED at 0x0100")
+	}
+
+	if cpu.Registers.P&D == 0 {
+		t.Error("D flag is not set")
+	}
+
+	Teardown()
+}
+
+// CheckStackBalance
+
+func TestCheckStackBalance(t *testing.T) {
+	Setup()
+
+	cpu.Memory.Store(0x0100, 0x20) // JSR $0200
+	cpu.Memory.Store(0x0101, 0x00)
+	cpu.Memory.Store(0x0102, 0x02)
+
+	cpu.Memory.Store(0x0200, 0x48) // PHA
+	cpu.Memory.Store(0x0201, 0x68) // PLA
+	cpu.Memory.Store(0x0202, 0x60) // RTS
+
+	cpu.Memory.Store(0x0300, 0x48) // PHA
+	cpu.Memory.Store(0x0301, 0x48) // PHA
+	cpu.Memory.Store(0x0302, 0x68) // PLA
+	cpu.Memory.Store(0x0303, 0x4c) // JMP $0303
+	cpu.Memory.Store(0x0304, 0x03)
+	cpu.Memory.Store(0x0305, 0x03)
+
+	balanced, delta := CheckStackBalance(cpu, func() {
+		cpu.Registers.PC = 0x0100
+		cpu.Trace(4)
+	})
+
+	if !balanced || delta != 0 {
+		t.Errorf("Balanced subroutine reported delta %d\n", delta)
+	}
+
+	if cpu.Registers.PC != 0x0103 {
+		t.Error("Register PC is not 0x0103")
+	}
+
+	balanced, delta = CheckStackBalance(cpu, func() {
+		cpu.Registers.PC = 0x0300
+		cpu.Trace(3)
+	})
+
+	if balanced || delta != 1 {
+		t.Errorf("Unbalanced handler reported delta %d, not 1\n", delta)
+	}
+
+	Teardown()
+}
+
+// Interrupt sequence
+
+func TestInterruptSequence(t *testing.T) {
+	for _, which := range []Interrupt{Irq, Nmi} {
+		Setup()
+
+		cpu.Registers.P = C | U
+		cpu.Registers.SP = 0xfd
+		cpu.Registers.PC = 0x0234
+
+		cpu.Memory.Store(0xfffa, 0x00) // NMI vector
+		cpu.Memory.Store(0xfffb, 0x03)
+		cpu.Memory.Store(0xfffe, 0x00) // IRQ vector
+		cpu.Memory.Store(0xffff, 0x03)
+
+		cpu.Memory.Store(0x0300, 0xea) // NOP
+
+		cpu.Interrupt(which, true)
+
+		cycles, err := cpu.Execute()
+
+		if err != nil {
+			t.Errorf("Error during Execute: %s\n", err)
+		}
+
+		if cycles != 7+2 {
+			t.Errorf("Interrupt %d: cycles is %d, not 9\n", which, cycles)
+		}
+
+		if cpu.Memory.Fetch(0x01fd) != 0x02 {
+			t.Error("Memory 0x01fd is not PCH 0x02")
+		}
+
+		if cpu.Memory.Fetch(0x01fc) != 0x34 {
+			t.Error("Memory 0x01fc is not PCL 0x34")
+		}
+
+		if cpu.Memory.Fetch(0x01fb) != uint8(C|U) {
+			t.Error("Memory 0x01fb is not P 0x21")
+		}
+
+		if cpu.Registers.SP != 0xfa {
+			t.Error("Register SP is not 0xfa")
+		}
+
+		if cpu.Registers.PC != 0x0301 {
+			t.Error("Register PC is not 0x0301")
+		}
+
+		Teardown()
+	}
+}
+
+// SetCycleAdjuster
+
+func TestSetCycleAdjuster(t *testing.T) {
+	Setup()
+
+	cpu.Cycles = make(chan uint16)
+
+	cpu.SetCycleAdjuster(func(cpu *M6502, op OpCode, baseCycles uint16) uint16 {
+		if inst, _ := cpu.Instructions.Lookup(op); inst.Mneumonic == "STA" {
+			return baseCycles + 2
+		}
+
+		return baseCycles
+	})
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x85) // STA $10
+	cpu.Memory.Store(0x0101, 0x10)
+	cpu.Memory.Store(0x0102, 0xa9) // LDA #$01
+	cpu.Memory.Store(0x0103, 0x01)
+	cpu.Memory.Store(0x0104, 0x02) // illegal opcode
+
+	awaited := make(chan []uint16)
+
+	go func() {
+		var cycles []uint16
+
+		for c := range cpu.Cycles {
+			cycles = append(cycles, c)
+			cpu.Cycles <- c
+
+			if len(cycles) == 2 {
+				break
+			}
+		}
+
+		awaited <- cycles
+	}()
+
+	total, _ := cpu.RunCount()
+	cycles := <-awaited
+
+	if len(cycles) != 2 || cycles[0] != 5 || cycles[1] != 2 {
+		t.Errorf("Awaited cycles are %v, not [5 2]\n", cycles)
+	}
+
+	if total != 7 {
+		t.Errorf("Total cycles is %d, not 7\n", total)
+	}
+
+	Teardown()
+}
+
+// Flag preserving reset
+
+func TestFlagPreservingReset(t *testing.T) {
+	Setup()
+
+	cpu.Registers.P = C | Z | U
+
+	cpu.Reset()
+
+	if cpu.Registers.P != I {
+		t.Error("Status is not 0x04 after Reset")
+	}
+
+	cpu.EnableFlagPreservingReset()
+
+	cpu.Registers.P = C | Z | U
+
+	cpu.Reset()
+
+	if cpu.Registers.P != C|Z|I|U {
+		t.Error("Status is not 0x27 after flag preserving Reset")
+	}
+
+	Teardown()
+}
+
+// SnapshotRegisters/RestoreRegisters
+
+func TestSnapshotRegisters(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+	cpu.Registers.A = 0x42
+
+	cpu.Memory.Store(0x0100, 0xa9) // LDA #$00
+	cpu.Memory.Store(0x0101, 0x00)
+
+	snapshot := cpu.SnapshotRegisters()
+
+	cpu.Execute()
+
+	if cpu.Registers == snapshot {
+		t.Error("Registers did not change after LDA")
+	}
+
+	cpu.RestoreRegisters(snapshot)
+
+	if cpu.Registers != snapshot {
+		t.Error("Registers do not match the snapshot")
+	}
+
+	if cpu.Registers.A != 0x42 || cpu.Registers.PC != 0x0100 {
+		t.Error("Registers A and PC are not 0x42 and 0x0100")
+	}
+
+	Teardown()
+}
+
+// Uninitialized vectors
+
+func TestOnUninitializedVector(t *testing.T) {
+	Setup()
+
+	var vectors []uint16
+
+	cpu.OnUninitializedVector(func(vector uint16) {
+		vectors = append(vectors, vector)
+	})
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x6c) // JMP ($0300)
+	cpu.Memory.Store(0x0101, 0x00)
+	cpu.Memory.Store(0x0102, 0x03)
+
+	cpu.Memory.Store(0x0200, 0x6c) // JMP ($0302)
+	cpu.Memory.Store(0x0201, 0x02)
+	cpu.Memory.Store(0x0202, 0x03)
+
+	cpu.Memory.Store(0x0302, 0x00) // vector to 0x0200
+	cpu.Memory.Store(0x0303, 0x02)
+
+	cpu.Execute()
+
+	if len(vectors) != 1 || vectors[0] != 0x0300 {
+		t.Fatal("Callback did not fire for vector 0x0300")
+	}
+
+	cpu.Registers.PC = 0x0200
+
+	cpu.Execute()
+
+	if len(vectors) != 1 {
+		t.Error("Callback fired for an initialized vector")
+	}
+
+	cpu.Interrupt(Nmi, true)
+	cpu.PerformInterrupts()
+
+	if len(vectors) != 2 || vectors[1] != 0xfffa {
+		t.Error("Callback did not fire for the NMI vector")
+	}
+
+	Teardown()
+}
+
+// RunLimited
+
+func TestRunLimited(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x4c) // JMP $0100
+	cpu.Memory.Store(0x0101, 0x00)
+	cpu.Memory.Store(0x0102, 0x01)
+
+	executed, err := cpu.RunLimited(1000)
+
+	if err != ErrInstructionLimit {
+		t.Error("Did not receive expected error ErrInstructionLimit")
+	}
+
+	if executed != 1000 {
+		t.Errorf("Executed %d instructions, not 1000\n", executed)
+	}
+
+	Teardown()
+
+	Setup()
+
+	loadCountdown(cpu)
+
+	executed, err = cpu.RunLimited(1000)
+
+	if _, ok := err.(BadOpCodeError); !ok {
+		t.Error("Did not receive expected error type BadOpCodeError")
+	}
+
+	// LDX + 255 * DEX + 255 * BNE
+	if executed != 1+255+255 {
+		t.Errorf("Executed %d instructions, not %d\n", executed, 1+255+255)
+	}
+
+	Teardown()
+}
+
+// IRQ
+
+func TestIRQ(t *testing.T) {
+	Setup()
+
+	cpu.Registers.P = C | I | U
+	cpu.Registers.PC = 0x0200
+
+	cpu.Memory.Store(0xfffe, 0x00) // IRQ vector
+	cpu.Memory.Store(0xffff, 0x03)
+
+	cpu.Memory.Store(0x0200, 0x58) // CLI
+	cpu.Memory.Store(0x0201, 0xea) // NOP
+	cpu.Memory.Store(0x0300, 0x40) // RTI
+
+	if cpu.IRQ() != 0 || cpu.Registers.PC != 0x0200 {
+		t.Error("IRQ serviced with the I flag set")
+	}
+
+	cpu.SetIRQ(true)
+
+	cpu.Execute()
+
+	if cpu.Registers.PC != 0x0201 {
+		t.Error("IRQ serviced before CLI executed")
+	}
+
+	cycles, _ := cpu.Execute()
+
+	if cpu.Registers.PC != 0x0201 {
+		t.Error("Register PC is not 0x0201 after IRQ and RTI")
+	}
+
+	if cycles != 7+6 {
+		t.Errorf("Cycles is %d, not 13\n", cycles)
+	}
+
+	if cpu.Memory.Fetch(0x01fb) != uint8(C|U) {
+		t.Error("Pushed status is not 0x21")
+	}
+
+	if cpu.Registers.P != C|U {
+		t.Error("Register P is not 0x21 after RTI")
+	}
+
+	// the line is still asserted, so the IRQ fires again
+	if cycles, _ := cpu.Execute(); cycles != 7+6 || cpu.Registers.PC != 0x0201 {
+		t.Error("Asserted IRQ line was not serviced again after RTI")
+	}
+
+	cpu.SetIRQ(false)
+
+	cpu.Execute()
+
+	if cpu.Registers.PC != 0x0202 {
+		t.Error("Register PC is not 0x0202 after NOP")
+	}
+
+	Teardown()
+}
+
+func TestNMI(t *testing.T) {
+	Setup()
+
+	cpu.Registers.P = I | U
+	cpu.Registers.PC = 0x0200
+
+	cpu.Memory.Store(0xfffa, 0x00) // NMI vector
+	cpu.Memory.Store(0xfffb, 0x03)
+
+	cpu.Memory.Store(0x0200, 0xea) // NOP
+	cpu.Memory.Store(0x0201, 0xea) // NOP
+	cpu.Memory.Store(0x0300, 0x40) // RTI
+
+	cpu.SetNMI()
+
+	cycles, _ := cpu.Execute()
+
+	if cpu.Registers.PC != 0x0200 {
+		t.Error("Register PC is not 0x0200 after NMI and RTI")
+	}
+
+	if cycles != 7+6 {
+		t.Errorf("Cycles is %d, not 13\n", cycles)
+	}
+
+	if cpu.Memory.Fetch(0x01fb) != uint8(I|U) {
+		t.Error("Pushed status is not 0x24")
+	}
+
+	if cpu.GetInterrupt(Nmi) {
+		t.Error("NMI latch is still set")
+	}
+
+	cpu.Execute()
+
+	if cpu.Registers.PC != 0x0201 {
+		t.Error("NMI serviced again without being re-triggered")
+	}
+
+	cpu.SetNMI()
+	cpu.Execute()
+
+	if cpu.Registers.PC != 0x0201 {
+		t.Error("Register PC is not 0x0201 after re-triggered NMI and RTI")
+	}
+
+	Teardown()
+}
+
+func TestWarmReset(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0200
+
+	cpu.Memory.Store(0x0200, 0xea) // NOP
+	cpu.Memory.Store(0xfffc, 0x34) // reset vector
+	cpu.Memory.Store(0xfffd, 0x12)
+
+	cpu.Execute()
+
+	cpu.Registers.A = 0x42
+	cpu.Registers.P = C | U
+	cpu.Registers.SP = 0x10
+
+	if cpu.WarmReset() != 7 {
+		t.Error("Cycles is not 7")
+	}
+
+	if cpu.Registers.PC != 0x1234 {
+		t.Error("Register PC is not 0x1234")
+	}
+
+	if cpu.Registers.SP != 0xfd {
+		t.Error("Register SP is not 0xfd")
+	}
+
+	if cpu.Registers.P&I == 0 {
+		t.Error("I flag is not set")
+	}
+
+	if cpu.Registers.A != 0x00 {
+		t.Error("Register A is not 0x00")
+	}
+
+	if cpu.Memory.Fetch(0x0200) != 0xea {
+		t.Error("Memory was cleared by WarmReset")
+	}
+
+	if cpu.CycleCount() != 2 {
+		t.Errorf("CycleCount is %d, not 2\n", cpu.CycleCount())
+	}
+
+	Teardown()
+}
+
+// RunCycles
+
+func TestRunCycles(t *testing.T) {
+	Setup()
+
+	loadCountdown(cpu)
+
+	// LDX (2) + DEX (2) + taken BNE (3)
+	executed, err := cpu.RunCycles(5)
+
+	if err != nil {
+		t.Error("Error during RunCycles")
+	}
+
+	if executed != 7 {
+		t.Errorf("Executed is %d, not 7\n", executed)
+	}
+
+	if cpu.Registers.PC != 0x0102 {
+		t.Error("Register PC is not 0x0102")
+	}
+
+	// DEX (2) + taken BNE (3)
+	executed, _ = cpu.RunCycles(5)
+
+	if executed != 5 {
+		t.Errorf("Executed is %d, not 5\n", executed)
+	}
+
+	if cpu.Registers.X != 0xfd {
+		t.Error("Register X is not 0xfd")
+	}
+
+	if executed, _ = cpu.RunCycles(0); executed != 0 {
+		t.Error("Instructions executed with a budget of 0")
+	}
+
+	_, err = cpu.RunCycles(0xf000)
+
+	if _, ok := err.(BadOpCodeError); !ok {
+		t.Error("Did not receive expected error type BadOpCodeError")
+	}
+
+	// a budget near the top of the range does not wrap the count
+	cpu.Registers.PC = 0x0200
+
+	for i := uint16(0x0200); i < 0x02ff; i++ {
+		cpu.Memory.Store(i, 0xea) // NOP
+	}
+
+	cpu.Memory.Store(0x02ff, 0x4c) // JMP $0200
+	cpu.Memory.Store(0x0300, 0x00)
+	cpu.Memory.Store(0x0301, 0x02)
+
+	start := cpu.CycleCount()
+
+	executed, err = cpu.RunCycles(0xffff)
+
+	if err != nil {
+		t.Errorf("Error during RunCycles: %s\n", err)
+	}
+
+	if executed != 0xffff {
+		t.Errorf("Executed is %#04x, not 0xffff\n", executed)
+	}
+
+	if cpu.CycleCount()-start < 0xffff {
+		t.Errorf("Executed only %d cycles\n", cpu.CycleCount()-start)
+	}
+
+	Teardown()
+}
+
+// Step
+
+func TestStep(t *testing.T) {
+	Setup()
+
+	// nothing services the channel, so any handshake would block
+	cpu.Cycles = make(chan uint16)
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9) // LDA #$01
+	cpu.Memory.Store(0x0101, 0x01)
+	cpu.Memory.Store(0x0102, 0x8d) // STA $0200
+	cpu.Memory.Store(0x0103, 0x00)
+	cpu.Memory.Store(0x0104, 0x02)
+	cpu.Memory.Store(0x0105, 0xe8) // INX
+
+	for i, step := range []struct {
+		pc     uint16
+		cycles uint16
+	}{{0x0102, 2}, {0x0105, 4}, {0x0106, 2}} {
+		cycles, err := cpu.Step()
+
+		if err != nil {
+			t.Errorf("Error during step %d\n", i)
+		}
+
+		if cpu.Registers.PC != step.pc {
+			t.Errorf("Register PC is not %#04x after step %d\n", step.pc, i)
+		}
+
+		if cycles != step.cycles {
+			t.Errorf("Cycles is %d, not %d after step %d\n", cycles, step.cycles, i)
+		}
+	}
+
+	if cpu.Memory.Fetch(0x0200) != 0x01 || cpu.Registers.X != 0x01 {
+		t.Error("Program did not execute correctly")
+	}
+
+	Teardown()
+}
+
+// SetTracer
+
+type captureTracer struct {
+	pcs     []uint16
+	opcodes []OpCode
+	lines   []string
+}
+
+func (tracer *captureTracer) Trace(pc uint16, opcode OpCode, text string) {
+	tracer.pcs = append(tracer.pcs, pc)
+	tracer.opcodes = append(tracer.opcodes, opcode)
+	tracer.lines = append(tracer.lines, text)
+}
+
+func TestSetTracer(t *testing.T) {
+	Setup()
+
+	tracer := &captureTracer{}
+
+	cpu.EnableDecode()
+	cpu.SetTracer(tracer)
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9) // LDA #$80
+	cpu.Memory.Store(0x0101, 0x80)
+	cpu.Memory.Store(0x0102, 0xe8) // INX
+	cpu.Memory.Store(0x0103, 0xea) // NOP
+
+	cpu.Execute()
+	cpu.Execute()
+	cpu.Execute()
+
+	pcs := []uint16{0x0100, 0x0102, 0x0103}
+	opcodes := []OpCode{0xa9, 0xe8, 0xea}
+	lines := []string{
+		"0100  A9 80     LDA #$80                        A:00 X:00 Y:00 P:24 SP:FD",
+		"0102  E8        INX                             A:80 X:00 Y:00 P:A4 SP:FD",
+		"0103  EA        NOP                             A:80 X:01 Y:00 P:24 SP:FD",
+	}
+
+	if len(tracer.lines) != len(lines) {
+		t.Fatalf("Tracer received %d lines, not %d\n", len(tracer.lines), len(lines))
+	}
+
+	for i := range lines {
+		if tracer.pcs[i] != pcs[i] {
+			t.Errorf("PC %d is %#04x, not %#04x\n", i, tracer.pcs[i], pcs[i])
+		}
+
+		if tracer.opcodes[i] != opcodes[i] {
+			t.Errorf("OpCode %d is %#02x, not %#02x\n", i, tracer.opcodes[i], opcodes[i])
+		}
+
+		if tracer.lines[i] != lines[i] {
+			t.Errorf("Line %d is %q, not %q\n", i, tracer.lines[i], lines[i])
+		}
+	}
+
+	Teardown()
+}
+
+// SetBreakpoint
+
+func TestSetBreakpoint(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9) // LDA #$01
+	cpu.Memory.Store(0x0101, 0x01)
+	cpu.Memory.Store(0x0102, 0xa2) // LDX #$02
+	cpu.Memory.Store(0x0103, 0x02)
+	cpu.Memory.Store(0x0104, 0xa0) // LDY #$03
+	cpu.Memory.Store(0x0105, 0x03)
+	cpu.Memory.Store(0x0106, 0xe8) // INX
+	cpu.Memory.Store(0x0107, 0x02) // illegal opcode
+
+	cpu.SetBreakpoint(0x0104)
+	cpu.SetBreakpoint(0x0106)
+
+	err := cpu.Run()
+
+	if b, ok := err.(BreakpointError); !ok {
+		t.Error("Did not receive expected error type BreakpointError")
+	} else if b != 0x0104 {
+		t.Error("BreakpointError is not 0x0104")
+	}
+
+	if cpu.Registers.PC != 0x0104 {
+		t.Error("Register PC is not 0x0104")
+	}
+
+	if cpu.Registers.A != 0x01 || cpu.Registers.X != 0x02 {
+		t.Error("Instructions before the breakpoint were not executed")
+	}
+
+	if cpu.Registers.Y != 0x00 {
+		t.Error("Breakpointed instruction was executed")
+	}
+
+	pc, err := cpu.RunUntilBreak()
+
+	if err != nil {
+		t.Error("Error during RunUntilBreak")
+	}
+
+	if pc != 0x0106 || cpu.Registers.PC != 0x0106 {
+		t.Error("RunUntilBreak did not stop at 0x0106")
+	}
+
+	if cpu.Registers.Y != 0x03 || cpu.Registers.X != 0x02 {
+		t.Error("Registers are not as expected at 0x0106")
+	}
+
+	cpu.ClearBreakpoint(0x0104)
+	cpu.Registers.PC = 0x0100
+
+	pc, err = cpu.RunUntilBreak()
+
+	if pc != 0x0106 || err != nil {
+		t.Error("Cleared breakpoint at 0x0104 was hit")
+	}
+
+	cpu.ClearBreakpoint(0x0106)
+
+	if _, err = cpu.RunUntilBreak(); err == nil {
+		t.Error("No error returned")
+	} else if _, ok := err.(BadOpCodeError); !ok {
+		t.Error("Did not receive expected error type BadOpCodeError")
+	}
+
+	Teardown()
+}
+
+// MarshalBinary
+
+func TestRegistersMarshalBinary(t *testing.T) {
+	Setup()
+
+	cpu.Registers = Registers{A: 0x12, X: 0x34, Y: 0x56, P: N | V | U | C, SP: 0x80, PC: 0xc0de}
+	saved := cpu.Registers
+
+	var marshaler encoding.BinaryMarshaler = cpu.Registers
+
+	data, err := marshaler.MarshalBinary()
+
+	if err != nil {
+		t.Error("Error during MarshalBinary")
+	}
+
+	cpu.Reset()
+
+	if cpu.Registers == saved {
+		t.Error("Reset did not change the registers")
+	}
+
+	var unmarshaler encoding.BinaryUnmarshaler = &cpu.Registers
+
+	if err = unmarshaler.UnmarshalBinary(data); err != nil {
+		t.Error("Error during UnmarshalBinary")
+	}
+
+	if cpu.Registers != saved {
+		t.Errorf("Registers are %+v, not %+v\n", cpu.Registers, saved)
+	}
+
+	if err = cpu.Registers.UnmarshalBinary(data[:6]); err == nil {
+		t.Error("No error returned for truncated data")
+	}
+
+	Teardown()
+}
+
+// MarshalJSON
+
+func TestRegistersMarshalJSON(t *testing.T) {
+	reg := Registers{A: 0x12, X: 0x34, Y: 0x56, P: N | U | I | C, SP: 0xfd, PC: 0xc0de}
+
+	data, err := json.Marshal(reg)
+
+	if err != nil {
+		t.Error("Error during MarshalJSON")
+	}
+
+	expected := `{"A":"0x12","X":"0x34","Y":"0x56",` +
+		`"P":{"N":true,"V":false,"U":true,"B":false,"D":false,"I":true,"Z":false,"C":true},` +
+		`"SP":"0xfd","PC":"0xc0de"}`
+
+	if string(data) != expected {
+		t.Errorf("JSON is %s, not %s\n", data, expected)
+	}
+
+	var decoded Registers
+
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Error("Error during UnmarshalJSON")
+	}
+
+	if decoded != reg {
+		t.Errorf("Registers are %+v, not %+v\n", decoded, reg)
+	}
+
+	if err = json.Unmarshal([]byte(`{"A":"0x100"}`), &decoded); err == nil {
+		t.Error("No error returned for out of range A")
+	}
+}
+
+// Halt
+
+func TestHalt(t *testing.T) {
+	Setup()
+
+	cpu.Registers.P = U
+	cpu.Registers.PC = 0x0200
+
+	cpu.Memory.Store(0xfffe, 0x00) // IRQ vector
+	cpu.Memory.Store(0xffff, 0x03)
+
+	cpu.Memory.Store(0x0200, 0xe8) // INX
+	cpu.Memory.Store(0x0300, 0xc8) // INY
+
+	cpu.Halt()
+
+	for i := 0; i < 3; i++ {
+		if cycles, err := cpu.Execute(); cycles != 1 || err != nil {
+			t.Error("Halted Execute did not return 1 cycle and no error")
+		}
+	}
+
+	// running a halted CPU advances time without spinning forever
+	if executed, err := cpu.RunCycles(10); executed != 10 || err != nil {
+		t.Errorf("RunCycles on a halted CPU returned %d, %v\n", executed, err)
+	}
+
+	if !cpu.Halted() || cpu.Registers.PC != 0x0200 {
+		t.Error("RunCycles resumed the halted CPU")
+	}
+
+	cpu.SetHaltCycles(0)
+
+	if _, err := cpu.RunCycles(10); err != ErrHalted {
+		t.Error("Did not receive expected error ErrHalted from RunCycles")
+	}
+
+	if err := cpu.Run(); err != ErrHalted {
+		t.Error("Did not receive expected error ErrHalted from Run")
+	}
+
+	cpu.SetHaltCycles(2)
+
+	if cycles, _ := cpu.Execute(); cycles != 2 {
+		t.Errorf("Cycles is %d, not 2\n", cycles)
+	}
+
+	if cpu.Registers.PC != 0x0200 || cpu.Registers.X != 0x00 {
+		t.Error("Halted CPU executed an instruction")
+	}
+
+	if !cpu.Halted() {
+		t.Error("CPU is not halted")
+	}
+
+	cpu.SetIRQ(true)
+
+	// IRQ (7) + INY (2)
+	if cycles, _ := cpu.Execute(); cycles != 9 {
+		t.Errorf("Cycles is %d, not 9\n", cycles)
+	}
+
+	if cpu.Halted() || cpu.Registers.PC != 0x0301 || cpu.Registers.Y != 0x01 {
+		t.Error("IRQ did not resume the halted CPU")
+	}
+
+	cpu.SetIRQ(false)
+
+	// a masked IRQ resumes without being serviced
+	cpu.Registers.PC = 0x0200
+	cpu.Registers.P = I | U
+
+	cpu.Halt()
+	cpu.Execute()
+
+	cpu.SetIRQ(true)
+	cpu.Execute()
+
+	if cpu.Halted() || cpu.Registers.PC != 0x0201 || cpu.Registers.X != 0x01 {
+		t.Error("Masked IRQ did not resume the halted CPU at the next instruction")
+	}
+
+	cpu.Halt()
+	cpu.WarmReset()
+
+	if cpu.Halted() {
+		t.Error("WarmReset did not resume the halted CPU")
+	}
+
+	Teardown()
+}
+
+// StrictPC
+
+func TestStrictPC(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0xffff
+
+	cpu.Memory.Store(0xffff, 0xa9) // LDA #$42
+	cpu.Memory.Store(0x0000, 0x42)
+
+	if _, err := cpu.Execute(); err != nil {
+		t.Error("Error during Execute")
+	}
+
+	if cpu.Registers.A != 0x42 || cpu.Registers.PC != 0x0001 {
+		t.Error("Instruction did not wrap silently")
+	}
+
+	cpu.EnableStrictPC()
+
+	cpu.Registers.A = 0x00
+	cpu.Registers.PC = 0xffff
+
+	_, err := cpu.Execute()
+
+	if p, ok := err.(PCWrapError); !ok {
+		t.Error("Did not receive expected error type PCWrapError")
+	} else if p != 0xffff {
+		t.Error("PCWrapError is not 0xffff")
+	}
+
+	if cpu.Registers.A != 0x00 || cpu.Registers.PC != 0xffff {
+		t.Error("Wrapping instruction was executed")
+	}
+
+	cpu.Memory.Store(0xfffe, 0xa9) // LDA #$01
+	cpu.Memory.Store(0xffff, 0x01)
+
+	cpu.Registers.PC = 0xfffe
+
+	if _, err = cpu.Execute(); err != nil || cpu.Registers.A != 0x01 {
+		t.Error("Instruction ending at 0xffff was not executed")
+	}
+
+	Teardown()
+}
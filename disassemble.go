@@ -0,0 +1,173 @@
+package m65go2
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Decodes the instruction stored at 'pc', reading memory with
+// 'fetch'.  Returns the opcode's description, the formatted
+// instruction and the number of bytes the instruction occupies.
+// Undefined opcodes are formatted as a one byte '.byte' directive.
+// Operands which extend past 0xffff are read from the bottom of
+// memory, just as the CPU would.
+func decodeInstruction(fetch func(address uint16) uint8, pc uint16) (info opcodeInfo, text string, size uint8) {
+	opcode := fetch(pc)
+	info = opcodes[opcode]
+
+	if info.mnemonic == "" {
+		return info, fmt.Sprintf(".byte $%02X", opcode), 1
+	}
+
+	low := fetch(pc + 1)
+	high := fetch(pc + 2)
+	address := (uint16(high) << 8) | uint16(low)
+
+	var operand string
+
+	switch info.mode {
+	case Accumulator:
+		operand = "A"
+	case Immediate:
+		operand = fmt.Sprintf("#$%02X", low)
+	case ZeroPage:
+		operand = fmt.Sprintf("$%02X", low)
+	case ZeroPageX:
+		operand = fmt.Sprintf("$%02X,X", low)
+	case ZeroPageY:
+		operand = fmt.Sprintf("$%02X,Y", low)
+	case Relative:
+		operand = fmt.Sprintf("$%04X", pc+2+uint16(int8(low)))
+	case Absolute:
+		operand = fmt.Sprintf("$%04X", address)
+	case AbsoluteX:
+		operand = fmt.Sprintf("$%04X,X", address)
+	case AbsoluteY:
+		operand = fmt.Sprintf("$%04X,Y", address)
+	case Indirect:
+		operand = fmt.Sprintf("($%04X)", address)
+	case IndexedIndirect:
+		operand = fmt.Sprintf("($%02X,X)", low)
+	case IndirectIndexed:
+		operand = fmt.Sprintf("($%02X),Y", low)
+	}
+
+	text = info.mnemonic
+
+	if operand != "" {
+		text += " " + operand
+	}
+
+	return info, text, 1 + info.mode.OperandSize()
+}
+
+// Returns the cycle annotation for an opcode.
+func (info opcodeInfo) cyclesString() string {
+	switch {
+	case info.mode == Relative:
+		return fmt.Sprintf("%d+2 cycles", info.cycles)
+	case info.pageCross:
+		return fmt.Sprintf("%d+1 cycles", info.cycles)
+	default:
+		return fmt.Sprintf("%d cycles", info.cycles)
+	}
+}
+
+// Disassembles each instruction starting at an address between
+// 'start' and 'end' inclusive and returns one line per instruction in
+// the form 'ADDR: MNEMONIC OPERAND ; N cycles'.  N is the base cost
+// of the instruction.  Instructions which take an extra cycle when
+// crossing a page boundary are annotated 'N+1' and branches 'N+2', one
+// extra cycle when the branch is taken and another when it crosses a
+// page boundary.
+func DisassembleWithCycles(mem Memory, start, end uint16) (lines []string) {
+	for pc := uint32(start); pc <= uint32(end); {
+		info, text, size := decodeInstruction(mem.Fetch, uint16(pc))
+
+		if info.mnemonic != "" {
+			text += " ; " + info.cyclesString()
+		}
+
+		lines = append(lines, fmt.Sprintf("%04X: %s", pc, text))
+		pc += uint32(size)
+	}
+
+	return
+}
+
+// Disassembles the instruction stored at 'pc' and returns it in the
+// form 'ADDR: MNEMONIC OPERAND' along with the address of the
+// following instruction, so that a listing can be produced by calling
+// DisassembleStep in a loop.  Undefined opcodes are formatted as a one
+// byte '.byte' directive.
+func DisassembleStep(mem Memory, pc uint16) (text string, next uint16) {
+	_, text, size := decodeInstruction(mem.Fetch, pc)
+	return fmt.Sprintf("%04X: %s", pc, text), pc + uint16(size)
+}
+
+// Disassembles each instruction starting at an address between
+// 'start' and 'end' inclusive and returns one line per instruction in
+// the form 'ADDR  BYTES     MNEMONIC OPERAND', where BYTES are the raw
+// opcode and operand bytes of the instruction, as in the lines printed
+// when decoding is enabled.  Undefined opcodes are formatted as a one
+// byte '.byte' directive.
+func DisassembleRange(mem Memory, start, end uint16) (lines []string) {
+	for pc := uint32(start); pc <= uint32(end); {
+		_, text, size := decodeInstruction(mem.Fetch, uint16(pc))
+
+		raw := make([]string, size)
+
+		for i := range raw {
+			raw[i] = fmt.Sprintf("%02X", mem.Fetch(uint16(pc)+uint16(i)))
+		}
+
+		lines = append(lines, fmt.Sprintf("%04X  %-8s  %s", pc, strings.Join(raw, " "), text))
+		pc += uint32(size)
+	}
+
+	return
+}
+
+// Returns an estimate of the number of cycles taken to execute each
+// instruction starting at an address between 'start' and 'end'
+// inclusive, once each, in order.  The estimate is the sum of the
+// instructions' base cycle counts, so it ignores branches, loops,
+// page crossing penalties and undefined opcodes, and is only accurate
+// for straight-line code.
+func EstimateCycles(mem Memory, start, end uint16) (cycles uint64) {
+	for pc := uint32(start); pc <= uint32(end); {
+		info, _, size := decodeInstruction(mem.Fetch, uint16(pc))
+		cycles += uint64(info.cycles)
+		pc += uint32(size)
+	}
+
+	return
+}
+
+// Disassembles 'code' as if it were stored in memory starting at
+// 'baseAddr' and returns one line per instruction in the form
+// 'ADDR: MNEMONIC OPERAND'.  A final instruction whose operands would
+// extend past the end of 'code' is formatted as '.byte' directives.
+func DisassembleBytes(code []byte, baseAddr uint16) (lines []string) {
+	fetch := func(address uint16) uint8 {
+		if i := int(address - baseAddr); i < len(code) {
+			return code[i]
+		}
+
+		return 0x00
+	}
+
+	for i := 0; i < len(code); {
+		pc := baseAddr + uint16(i)
+		_, text, size := decodeInstruction(fetch, pc)
+
+		if i+int(size) > len(code) {
+			text, size = fmt.Sprintf(".byte $%02X", code[i]), 1
+		}
+
+		lines = append(lines, fmt.Sprintf("%04X: %s", pc, text))
+		i += int(size)
+	}
+
+	return
+}
@@ -0,0 +1,191 @@
+package m65go2
+
+import "testing"
+
+func TestDisassembleWithCycles(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	for i, b := range []uint8{
+		0xa9, 0x01, // LDA #$01
+		0xbd, 0x00, 0x02, // LDA $0200,X
+		0x9d, 0x00, 0x03, // STA $0300,X
+		0xd0, 0xf6, // BNE $0300
+		0x0a, // ASL A
+		0x02, // undefined
+	} {
+		mem.Store(0x0300+uint16(i), b)
+	}
+
+	expected := []string{
+		"0300: LDA #$01 ; 2 cycles",
+		"0302: LDA $0200,X ; 4+1 cycles",
+		"0305: STA $0300,X ; 5 cycles",
+		"0308: BNE $0300 ; 2+2 cycles",
+		"030A: ASL A ; 2 cycles",
+		"030B: .byte $02",
+	}
+
+	lines := DisassembleWithCycles(mem, 0x0300, 0x030b)
+
+	if len(lines) != len(expected) {
+		t.Fatalf("Got %d lines, not %d\n", len(lines), len(expected))
+	}
+
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Line %d is %q, not %q\n", i, lines[i], expected[i])
+		}
+	}
+}
+
+func TestDisassembleStep(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	for i, b := range []uint8{
+		0xa2, 0x05, // LDX #$05
+		0xca,       // DEX
+		0xd0, 0xfd, // BNE $0602
+		0x02,             // undefined
+		0x4c, 0x00, 0x06, // JMP $0600
+	} {
+		mem.Store(0x0600+uint16(i), b)
+	}
+
+	expected := []struct {
+		text string
+		next uint16
+	}{
+		{"0600: LDX #$05", 0x0602},
+		{"0602: DEX", 0x0603},
+		{"0603: BNE $0602", 0x0605},
+		{"0605: .byte $02", 0x0606},
+		{"0606: JMP $0600", 0x0609},
+	}
+
+	pc := uint16(0x0600)
+
+	for i, e := range expected {
+		text, next := DisassembleStep(mem, pc)
+
+		if text != e.text {
+			t.Errorf("Line %d is %q, not %q\n", i, text, e.text)
+		}
+
+		if next != e.next {
+			t.Errorf("Line %d: next is %#04x, not %#04x\n", i, next, e.next)
+		}
+
+		pc = next
+	}
+}
+
+func TestDisassembleWrap(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	mem.Store(0xffff, 0xad) // LDA $1234
+	mem.Store(0x0000, 0x34)
+	mem.Store(0x0001, 0x12)
+
+	text, next := DisassembleStep(mem, 0xffff)
+
+	if text != "FFFF: LDA $1234" {
+		t.Errorf("Line is %q, not %q\n", text, "FFFF: LDA $1234")
+	}
+
+	if next != 0x0002 {
+		t.Errorf("Next is %#04x, not 0x0002\n", next)
+	}
+
+	lines := DisassembleWithCycles(mem, 0xffff, 0xffff)
+
+	if len(lines) != 1 || lines[0] != "FFFF: LDA $1234 ; 4 cycles" {
+		t.Errorf("Lines are %q, not [\"FFFF: LDA $1234 ; 4 cycles\"]\n", lines)
+	}
+}
+
+func TestEstimateCycles(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	for i, b := range []uint8{
+		0xa9, 0x01, // LDA #$01, 2 cycles
+		0x85, 0x10, // STA $10, 3 cycles
+		0xee, 0x00, 0x02, // INC $0200, 6 cycles
+		0xa2, 0x03, // LDX #$03, 2 cycles
+		0xbd, 0x00, 0x02, // LDA $0200,X, 4 cycles
+		0x48,             // PHA, 3 cycles
+		0x20, 0x00, 0x03, // JSR $0300, 6 cycles
+	} {
+		mem.Store(0x0600+uint16(i), b)
+	}
+
+	if cycles := EstimateCycles(mem, 0x0600, 0x060d); cycles != 26 {
+		t.Errorf("Estimate is %d cycles, not 26\n", cycles)
+	}
+}
+
+func TestDisassembleBytes(t *testing.T) {
+	code := []byte{
+		0xa9, 0x0a, // LDA #$0A
+		0x8d, 0x00, 0x20, // STA $2000
+		0xd0, 0xf9, // BNE $C000
+		0x02,       // undefined
+		0xad, 0x34, // truncated LDA
+	}
+
+	expected := []string{
+		"C000: LDA #$0A",
+		"C002: STA $2000",
+		"C005: BNE $C000",
+		"C007: .byte $02",
+		"C008: .byte $AD",
+		"C009: .byte $34",
+	}
+
+	lines := DisassembleBytes(code, 0xc000)
+
+	if len(lines) != len(expected) {
+		t.Fatalf("Got %d lines, not %d\n", len(lines), len(expected))
+	}
+
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Line %d is %q, not %q\n", i, lines[i], expected[i])
+		}
+	}
+}
+
+func TestDisassembleRange(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	for i, b := range []uint8{
+		0xa9, 0x01, // LDA #$01
+		0x8d, 0x00, 0x02, // STA $0200
+		0x0a,       // ASL A
+		0x02,       // undefined
+		0xd0, 0xf7, // BNE $C000
+		0x4c, 0x00, 0xc0, // JMP $C000
+	} {
+		mem.Store(0xc000+uint16(i), b)
+	}
+
+	expected := []string{
+		"C000  A9 01     LDA #$01",
+		"C002  8D 00 02  STA $0200",
+		"C005  0A        ASL A",
+		"C006  02        .byte $02",
+		"C007  D0 F7     BNE $C000",
+		"C009  4C 00 C0  JMP $C000",
+	}
+
+	lines := DisassembleRange(mem, 0xc000, 0xc009)
+
+	if len(lines) != len(expected) {
+		t.Fatalf("Got %d lines, not %d\n", len(lines), len(expected))
+	}
+
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Line %d is %q, not %q\n", i, lines[i], expected[i])
+		}
+	}
+}
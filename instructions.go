@@ -5,125 +5,162 @@ type OpCode uint8
 
 // Represents an instruction for the 6502 CPU.  The Exec field
 // implements the instruction and returns the total clock cycles to be
-// consumed by the instruction.
+// consumed by the instruction.  The CPU passes Exec the instruction
+// being executed, so one Exec function can serve several opcodes.
 type Instruction struct {
 	Mneumonic string
 	OpCode    OpCode
-	Exec      func(*M6502) (cycles uint16)
+	Exec      func(*M6502, *Instruction) (cycles uint16)
+	mode      AddressingMode
+	size      uint8
+	cycles    uint8
+	pageCross bool
+	illegal   bool
+}
+
+// Returns the instruction's mnemonic.
+func (inst Instruction) Mnemonic() string {
+	return inst.Mneumonic
+}
+
+// Returns the addressing mode used by the instruction.  Only
+// instructions added by InitInstructions carry metadata, others
+// report Implied.
+func (inst Instruction) Mode() AddressingMode {
+	return inst.mode
+}
+
+// Returns the number of bytes the instruction occupies, including its
+// opcode, or 0 for instructions not added by InitInstructions.
+func (inst Instruction) Size() uint8 {
+	return inst.size
+}
+
+// Returns the instruction's base number of cycles, excluding any page
+// crossing or branch penalties, or 0 for instructions not added by
+// InitInstructions.
+func (inst Instruction) Cycles() uint8 {
+	return inst.cycles
 }
 
 // Stores instructions understood by the 6502 CPU, indexed by opcode.
-type InstructionTable map[OpCode]Instruction
+// Like a map, an InstructionTable refers to its instructions, so
+// copies of it share them.  They are kept in an array rather than a
+// map so that dispatching an opcode is a plain index; an entry whose
+// Exec function is nil holds no instruction.  The zero value is an
+// empty InstructionTable ready to use.
+type InstructionTable struct {
+	insts *[256]Instruction
+}
 
 // Returns a new, empty InstructionTable
 func NewInstructionTable() InstructionTable {
-	instructions := make(map[OpCode]Instruction)
-	return instructions
+	return InstructionTable{insts: new([256]Instruction)}
+}
+
+// Returns the instruction with the given opcode and whether the
+// InstructionTable holds one.
+func (instructions *InstructionTable) Lookup(opcode OpCode) (inst Instruction, ok bool) {
+	if p := instructions.lookup(opcode); p != nil {
+		return *p, true
+	}
+
+	return
+}
+
+// Returns the instruction with the given opcode in place, so the CPU
+// can pass it to Exec without copying it to the heap, or nil if the
+// InstructionTable holds none.
+func (instructions *InstructionTable) lookup(opcode OpCode) *Instruction {
+	if instructions.insts == nil || instructions.insts[opcode].Exec == nil {
+		return nil
+	}
+
+	return &instructions.insts[opcode]
 }
 
 // Adds an instruction to the InstructionTable
-func (instructions InstructionTable) AddInstruction(inst Instruction) {
-	instructions[inst.OpCode] = inst
+func (instructions *InstructionTable) AddInstruction(inst Instruction) {
+	if instructions.insts == nil {
+		instructions.insts = new([256]Instruction)
+	}
+
+	instructions.insts[inst.OpCode] = inst
 }
 
 // Removes any instruction with the given opcode
-func (instructions InstructionTable) RemoveInstruction(opcode OpCode) {
-	delete(instructions, opcode)
+func (instructions *InstructionTable) RemoveInstruction(opcode OpCode) {
+	if instructions.insts != nil {
+		instructions.insts[opcode] = Instruction{}
+	}
+}
+
+// Adds each of the given instructions to the InstructionTable
+func (instructions *InstructionTable) AddAll(insts []Instruction) {
+	for _, inst := range insts {
+		instructions.AddInstruction(inst)
+	}
 }
 
 // Adds the 6502 CPU's instruction set to the InstructionTable.
-func (instructions InstructionTable) InitInstructions() {
-	// LDA
+func (instructions *InstructionTable) InitInstructions() {
+	var insts []Instruction
 
-	for _, o := range []OpCode{0xa1, 0xa5, 0xa9, 0xad, 0xb1, 0xb5, 0xb9, 0xbd} {
-		opcode := o
+	// LDA
 
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "LDA",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Lda(cpu.aluAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("LDA", []OpCode{0xa1, 0xa5, 0xa9, 0xad, 0xb1, 0xb5, 0xb9, 0xbd},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Lda(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// LDX
 
-	for _, o := range []OpCode{0xa2, 0xa6, 0xae, 0xb6, 0xbe} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "LDX",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Ldx(cpu.rmwAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("LDX", []OpCode{0xa2, 0xa6, 0xae, 0xb6, 0xbe},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Ldx(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// LDY
 
-	for _, o := range []OpCode{0xa0, 0xa4, 0xac, 0xb4, 0xbc} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "LDY",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Ldy(cpu.controlAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("LDY", []OpCode{0xa0, 0xa4, 0xac, 0xb4, 0xbc},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Ldy(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// STA
 
-	for _, o := range []OpCode{0x81, 0x85, 0x8d, 0x91, 0x95, 0x99, 0x9d} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "STA",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Sta(cpu.aluAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("STA", []OpCode{0x81, 0x85, 0x8d, 0x91, 0x95, 0x99, 0x9d},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Sta(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// STX
 
-	for _, o := range []OpCode{0x86, 0x8e, 0x96} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "STX",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Stx(cpu.rmwAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("STX", []OpCode{0x86, 0x8e, 0x96},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Stx(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// STY
 
-	for _, o := range []OpCode{0x84, 0x8c, 0x94} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "STY",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Sty(cpu.controlAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("STY", []OpCode{0x84, 0x8c, 0x94},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Sty(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// TAX
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "TAX",
 		OpCode:    0xaa,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Tax()
 			return
@@ -132,10 +169,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// TAY
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "TAY",
 		OpCode:    0xa8,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Tay()
 			return
@@ -144,10 +181,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// TXA
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "TXA",
 		OpCode:    0x8a,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Txa()
 			return
@@ -156,10 +193,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// TYA
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "TYA",
 		OpCode:    0x98,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Tya()
 			return
@@ -168,10 +205,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// TSX
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "TSX",
 		OpCode:    0xba,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Tsx()
 			return
@@ -180,10 +217,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// TXS
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "TXS",
 		OpCode:    0x9a,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Txs()
 			return
@@ -192,10 +229,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// PHA
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "PHA",
 		OpCode:    0x48,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 3
 			cpu.Pha()
 			return
@@ -204,10 +241,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// PHP
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "PHP",
 		OpCode:    0x08,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 3
 			cpu.Php()
 			return
@@ -216,10 +253,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// PLA
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "PLA",
 		OpCode:    0x68,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 4
 			cpu.Pla()
 			return
@@ -228,10 +265,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// PLP
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "PLP",
 		OpCode:    0x28,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 4
 			cpu.Plp()
 			return
@@ -239,258 +276,165 @@ func (instructions InstructionTable) InitInstructions() {
 
 	// AND
 
-	for _, o := range []OpCode{0x21, 0x25, 0x29, 0x2d, 0x31, 0x35, 0x39, 0x3d} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "AND",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.And(cpu.aluAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("AND", []OpCode{0x21, 0x25, 0x29, 0x2d, 0x31, 0x35, 0x39, 0x3d},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.And(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// EOR
 
-	for _, o := range []OpCode{0x41, 0x45, 0x49, 0x4d, 0x51, 0x55, 0x59, 0x5d} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "EOR",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Eor(cpu.aluAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("EOR", []OpCode{0x41, 0x45, 0x49, 0x4d, 0x51, 0x55, 0x59, 0x5d},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Eor(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// ORA
 
-	for _, o := range []OpCode{0x01, 0x05, 0x09, 0x0d, 0x11, 0x15, 0x19, 0x1d} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "ORA",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Ora(cpu.aluAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("ORA", []OpCode{0x01, 0x05, 0x09, 0x0d, 0x11, 0x15, 0x19, 0x1d},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Ora(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// BIT
 
-	for _, o := range []OpCode{0x24, 0x2c} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "BIT",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Bit(cpu.controlAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("BIT", []OpCode{0x24, 0x2c},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Bit(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// ADC
 
-	for _, o := range []OpCode{0x61, 0x65, 0x69, 0x6d, 0x71, 0x75, 0x79, 0x7d} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "ADC",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Adc(cpu.aluAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("ADC", []OpCode{0x61, 0x65, 0x69, 0x6d, 0x71, 0x75, 0x79, 0x7d},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Adc(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// SBC
 
-	for _, o := range []OpCode{0xe1, 0xe5, 0xeb, 0xe9, 0xed, 0xf1, 0xf5, 0xf9, 0xfd} {
-		opcode := o
-		mneumonic := ""
-
-		if opcode == 0xeb {
-			mneumonic = "*"
-		}
+	sbc := func(cpu *M6502, inst *Instruction) (cycles uint16) {
+		cpu.Sbc(cpu.address(inst, &cycles))
+		return
+	}
 
-		mneumonic += "SBC"
+	insts = append(insts, group("SBC", []OpCode{0xe1, 0xe5, 0xe9, 0xed, 0xf1, 0xf5, 0xf9, 0xfd}, sbc)...)
 
-		instructions.AddInstruction(Instruction{
-			Mneumonic: mneumonic,
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Sbc(cpu.aluAddress(opcode, &cycles))
-				return
-			}})
-	}
+	//     Unofficial
+	insts = append(insts, group("*SBC", []OpCode{0xeb}, sbc)...)
 
 	// DCP
 
-	for _, o := range []OpCode{0xc3, 0xc7, 0xcf, 0xd3, 0xd7, 0xdb, 0xdf} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*DCP",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Dcp(cpu.unofficialAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("*DCP", []OpCode{0xc3, 0xc7, 0xcf, 0xd3, 0xd7, 0xdb, 0xdf},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Dcp(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// ISB
 
-	for _, o := range []OpCode{0xe3, 0xe7, 0xef, 0xf3, 0xf7, 0xfb, 0xff} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*ISB",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Isb(cpu.unofficialAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("*ISB", []OpCode{0xe3, 0xe7, 0xef, 0xf3, 0xf7, 0xfb, 0xff},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Isb(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// SLO
 
-	for _, o := range []OpCode{0x03, 0x07, 0x0f, 0x13, 0x17, 0x1b, 0x1f} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*SLO",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Slo(cpu.unofficialAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("*SLO", []OpCode{0x03, 0x07, 0x0f, 0x13, 0x17, 0x1b, 0x1f},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Slo(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// RLA
 
-	for _, o := range []OpCode{0x23, 0x27, 0x2f, 0x33, 0x37, 0x3b, 0x3f} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*RLA",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Rla(cpu.unofficialAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("*RLA", []OpCode{0x23, 0x27, 0x2f, 0x33, 0x37, 0x3b, 0x3f},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Rla(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// SRE
 
-	for _, o := range []OpCode{0x43, 0x47, 0x4f, 0x53, 0x57, 0x5b, 0x5f} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*SRE",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Sre(cpu.unofficialAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("*SRE", []OpCode{0x43, 0x47, 0x4f, 0x53, 0x57, 0x5b, 0x5f},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Sre(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// RRA
 
-	for _, o := range []OpCode{0x63, 0x67, 0x6f, 0x73, 0x77, 0x7b, 0x7f} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*RRA",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Rra(cpu.unofficialAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("*RRA", []OpCode{0x63, 0x67, 0x6f, 0x73, 0x77, 0x7b, 0x7f},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Rra(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// CMP
 
-	for _, o := range []OpCode{0xc1, 0xc5, 0xc9, 0xcd, 0xd1, 0xd5, 0xd9, 0xdd} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "CMP",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Cmp(cpu.aluAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("CMP", []OpCode{0xc1, 0xc5, 0xc9, 0xcd, 0xd1, 0xd5, 0xd9, 0xdd},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Cmp(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// CPX
 
-	for _, o := range []OpCode{0xe0, 0xe4, 0xec} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "CPX",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Cpx(cpu.controlAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("CPX", []OpCode{0xe0, 0xe4, 0xec},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Cpx(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// CPY
 
-	for _, o := range []OpCode{0xc0, 0xc4, 0xcc} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "CPY",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Cpy(cpu.controlAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("CPY", []OpCode{0xc0, 0xc4, 0xcc},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Cpy(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// INC
 
 	//     Zero Page
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "INC",
 		OpCode:    0xe6,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 5
 			cpu.Inc(cpu.zeroPageAddress())
 			return
 		}})
 
 	//     Zero Page,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "INC",
 		OpCode:    0xf6,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Inc(cpu.zeroPageIndexedAddress(X))
 			return
 		}})
 
 	//     Absolute
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "INC",
 		OpCode:    0xee,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Inc(cpu.absoluteAddress())
 			return
 		}})
 
 	//     Absolute,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "INC",
 		OpCode:    0xfe,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Inc(cpu.absoluteIndexedAddress(X, &cycles))
 			cycles = 7
 			return
@@ -499,10 +443,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// INX
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "INX",
 		OpCode:    0xe8,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Inx()
 			return
@@ -511,10 +455,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// INY
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "INY",
 		OpCode:    0xc8,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Iny()
 			return
@@ -523,40 +467,40 @@ func (instructions InstructionTable) InitInstructions() {
 	// DEC
 
 	//     Zero Page
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "DEC",
 		OpCode:    0xc6,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 5
 			cpu.Dec(cpu.zeroPageAddress())
 			return
 		}})
 
 	//     Zero Page,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "DEC",
 		OpCode:    0xd6,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Dec(cpu.zeroPageIndexedAddress(X))
 			return
 		}})
 
 	//     Absolute
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "DEC",
 		OpCode:    0xce,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Dec(cpu.absoluteAddress())
 			return
 		}})
 
 	//     Absolute,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "DEC",
 		OpCode:    0xde,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Dec(cpu.absoluteIndexedAddress(X, &cycles))
 			cycles = 7
 			return
@@ -565,10 +509,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// DEX
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "DEX",
 		OpCode:    0xca,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Dex()
 			return
@@ -577,10 +521,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// DEY
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "DEY",
 		OpCode:    0x88,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Dey()
 			return
@@ -589,50 +533,50 @@ func (instructions InstructionTable) InitInstructions() {
 	// ASL
 
 	//     Accumulator
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ASL",
 		OpCode:    0x0a,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.AslA()
 			return
 		}})
 
 	//     Zero Page
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ASL",
 		OpCode:    0x06,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 5
 			cpu.Asl(cpu.zeroPageAddress())
 			return
 		}})
 
 	//     Zero Page,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ASL",
 		OpCode:    0x16,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Asl(cpu.zeroPageIndexedAddress(X))
 			return
 		}})
 
 	//     Absolute
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ASL",
 		OpCode:    0x0e,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Asl(cpu.absoluteAddress())
 			return
 		}})
 
 	//     Absolute,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ASL",
 		OpCode:    0x1e,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Asl(cpu.absoluteIndexedAddress(X, &cycles))
 			cycles = 7
 			return
@@ -641,50 +585,50 @@ func (instructions InstructionTable) InitInstructions() {
 	// LSR
 
 	//     Accumulator
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "LSR",
 		OpCode:    0x4a,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.LsrA()
 			return
 		}})
 
 	//     Zero Page
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "LSR",
 		OpCode:    0x46,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 5
 			cpu.Lsr(cpu.zeroPageAddress())
 			return
 		}})
 
 	//     Zero Page,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "LSR",
 		OpCode:    0x56,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Lsr(cpu.zeroPageIndexedAddress(X))
 			return
 		}})
 
 	//     Absolute
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "LSR",
 		OpCode:    0x4e,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Lsr(cpu.absoluteAddress())
 			return
 		}})
 
 	//     Absolute,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "LSR",
 		OpCode:    0x5e,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Lsr(cpu.absoluteIndexedAddress(X, &cycles))
 			cycles = 7
 			return
@@ -693,50 +637,50 @@ func (instructions InstructionTable) InitInstructions() {
 	// ROL
 
 	//     Accumulator
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROL",
 		OpCode:    0x2a,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.RolA()
 			return
 		}})
 
 	//     Zero Page
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROL",
 		OpCode:    0x26,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 5
 			cpu.Rol(cpu.zeroPageAddress())
 			return
 		}})
 
 	//     Zero Page,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROL",
 		OpCode:    0x36,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Rol(cpu.zeroPageIndexedAddress(X))
 			return
 		}})
 
 	//     Absolute
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROL",
 		OpCode:    0x2e,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Rol(cpu.absoluteAddress())
 			return
 		}})
 
 	//     Absolute,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROL",
 		OpCode:    0x3e,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Rol(cpu.absoluteIndexedAddress(X, &cycles))
 			cycles = 7
 			return
@@ -745,50 +689,50 @@ func (instructions InstructionTable) InitInstructions() {
 	// ROR
 
 	//     Accumulator
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROR",
 		OpCode:    0x6a,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.RorA()
 			return
 		}})
 
 	//     Zero Page
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROR",
 		OpCode:    0x66,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 5
 			cpu.Ror(cpu.zeroPageAddress())
 			return
 		}})
 
 	//     Zero Page,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROR",
 		OpCode:    0x76,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Ror(cpu.zeroPageIndexedAddress(X))
 			return
 		}})
 
 	//     Absolute
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROR",
 		OpCode:    0x6e,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Ror(cpu.absoluteAddress())
 			return
 		}})
 
 	//     Absolute,X
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "ROR",
 		OpCode:    0x7e,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Ror(cpu.absoluteIndexedAddress(X, &cycles))
 			cycles = 7
 			return
@@ -797,20 +741,20 @@ func (instructions InstructionTable) InitInstructions() {
 	// JMP
 
 	//     Absolute
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "JMP",
 		OpCode:    0x4c,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 3
 			cpu.Jmp(cpu.absoluteAddress())
 			return
 		}})
 
 	//     Indirect
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "JMP",
 		OpCode:    0x6c,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 5
 			cpu.Jmp(cpu.indirectAddress())
 			return
@@ -819,10 +763,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// JSR
 
 	//     Absolute
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "JSR",
 		OpCode:    0x20,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Jsr(cpu.absoluteAddress())
 			return
@@ -831,10 +775,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// RTS
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "RTS",
 		OpCode:    0x60,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Rts()
 			return
@@ -843,10 +787,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// BCC
 
 	//     Relative
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "BCC",
 		OpCode:    0x90,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Bcc(cpu.controlAddress(0x90, &cycles), &cycles)
 			return
 		}})
@@ -854,10 +798,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// BCS
 
 	//     Relative
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "BCS",
 		OpCode:    0xb0,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Bcs(cpu.controlAddress(0xb0, &cycles), &cycles)
 			return
 		}})
@@ -865,10 +809,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// BEQ
 
 	//     Relative
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "BEQ",
 		OpCode:    0xf0,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Beq(cpu.controlAddress(0xf0, &cycles), &cycles)
 			return
 		}})
@@ -876,10 +820,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// BMI
 
 	//     Relative
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "BMI",
 		OpCode:    0x30,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Bmi(cpu.controlAddress(0x30, &cycles), &cycles)
 			return
 		}})
@@ -887,10 +831,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// BNE
 
 	//     Relative
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "BNE",
 		OpCode:    0xd0,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Bne(cpu.controlAddress(0xd0, &cycles), &cycles)
 			return
 		}})
@@ -898,10 +842,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// BPL
 
 	//     Relative
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "BPL",
 		OpCode:    0x10,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Bpl(cpu.controlAddress(0x10, &cycles), &cycles)
 			return
 		}})
@@ -909,10 +853,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// BVC
 
 	//     Relative
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "BVC",
 		OpCode:    0x50,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Bvc(cpu.controlAddress(0x50, &cycles), &cycles)
 			return
 		}})
@@ -920,10 +864,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// BVS
 
 	//     Relative
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "BVS",
 		OpCode:    0x70,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cpu.Bvs(cpu.controlAddress(0x70, &cycles), &cycles)
 			return
 		}})
@@ -931,10 +875,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// CLC
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "CLC",
 		OpCode:    0x18,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Clc()
 			return
@@ -943,10 +887,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// CLD
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "CLD",
 		OpCode:    0xd8,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Cld()
 			return
@@ -955,10 +899,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// CLI
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "CLI",
 		OpCode:    0x58,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Cli()
 			return
@@ -967,10 +911,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// CLV
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "CLV",
 		OpCode:    0xb8,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Clv()
 			return
@@ -979,10 +923,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// SEC
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "SEC",
 		OpCode:    0x38,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Sec()
 			return
@@ -991,10 +935,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// SED
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "SED",
 		OpCode:    0xf8,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Sed()
 			return
@@ -1003,10 +947,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// SEI
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "SEI",
 		OpCode:    0x78,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Sei()
 			return
@@ -1015,10 +959,10 @@ func (instructions InstructionTable) InitInstructions() {
 	// BRK
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "BRK",
 		OpCode:    0x00,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 7
 			cpu.Brk()
 			return
@@ -1027,119 +971,232 @@ func (instructions InstructionTable) InitInstructions() {
 	// NOP
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "NOP",
 		OpCode:    0xea,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 2
 			cpu.Nop()
 			return
 		}})
 
 	//     Unofficial
+	insts = append(insts, group("*NOP", []OpCode{0x1a, 0x3a, 0x5a, 0x7a, 0xda, 0xfa},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 2
+			cpu.Nop()
+			return
+		})...)
 
-	for _, o := range []OpCode{0x1a, 0x3a, 0x5a, 0x7a, 0xda, 0xfa} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*NOP",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cycles = 2
-				cpu.Nop()
-				return
-			}})
-	}
-
-	for _, o := range []OpCode{0x04, 0x14, 0x34, 0x44, 0x54, 0x64, 0x74, 0xd4, 0xf4, 0x80} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*NOP",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				var address uint16
-
-				switch {
-				case opcode == 0x80:
-					cycles = 2
-					address = cpu.immediateAddress()
-				case (opcode>>4)&0x01 == 0:
-					cycles = 3
-					address = cpu.zeroPageAddress()
-				default:
-					cycles = 4
-					address = cpu.zeroPageIndexedAddress(X)
-				}
-
-				cpu.NopAddress(address)
-				return
-			}})
+	nop := func(cpu *M6502, inst *Instruction) (cycles uint16) {
+		cpu.NopAddress(cpu.address(inst, &cycles))
+		return
 	}
 
-	for _, o := range []OpCode{0x0c, 0x1c, 0x3c, 0x5c, 0x7c, 0xdc, 0xfc} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*NOP",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				var address uint16
-
-				cycles = 4
+	insts = append(insts, group("*NOP", []OpCode{0x04, 0x14, 0x34, 0x44, 0x54, 0x64, 0x74, 0xd4, 0xf4, 0x80}, nop)...)
 
-				if (opcode>>4)&0x01 == 0 {
-					address = cpu.absoluteAddress()
-				} else {
-					address = cpu.absoluteIndexedAddress(X, &cycles)
-				}
-
-				cpu.NopAddress(address)
-				return
-			}})
-	}
+	insts = append(insts, group("*NOP", []OpCode{0x0c, 0x1c, 0x3c, 0x5c, 0x7c, 0xdc, 0xfc}, nop)...)
 
 	// LAX
 
 	//     Unofficial
-
-	for _, o := range []OpCode{0xa3, 0xa7, 0xaf, 0xb3, 0xb7, 0xbf} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*LAX",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Lax(cpu.unofficialAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("*LAX", []OpCode{0xa3, 0xa7, 0xaf, 0xb3, 0xb7, 0xbf},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Lax(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// SAX
 
 	//     Unofficial
-
-	for _, o := range []OpCode{0x83, 0x87, 0x8f, 0x97} {
-		opcode := o
-
-		instructions.AddInstruction(Instruction{
-			Mneumonic: "*SAX",
-			OpCode:    opcode,
-			Exec: func(cpu *M6502) (cycles uint16) {
-				cpu.Sax(cpu.unofficialAddress(opcode, &cycles))
-				return
-			}})
-	}
+	insts = append(insts, group("*SAX", []OpCode{0x83, 0x87, 0x8f, 0x97},
+		func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cpu.Sax(cpu.address(inst, &cycles))
+			return
+		})...)
 
 	// RTI
 
 	//     Implied
-	instructions.AddInstruction(Instruction{
+	insts = append(insts, Instruction{
 		Mneumonic: "RTI",
 		OpCode:    0x40,
-		Exec: func(cpu *M6502) (cycles uint16) {
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
 			cycles = 6
 			cpu.Rti()
 			return
 		}})
+
+	instructions.AddAll(describe(insts, &opcodes))
+}
+
+// Adds the instruction set of the given member of the 6502 family to
+// the InstructionTable.
+func (instructions *InstructionTable) InitVariantInstructions(variant Variant) {
+	instructions.InitInstructions()
+
+	if variant == CMOS65C02 {
+		// the 65C02 has none of the NMOS 6502's undocumented opcodes
+		for opcode, inst := range instructions.insts {
+			if inst.illegal {
+				instructions.RemoveInstruction(OpCode(opcode))
+			}
+		}
+
+		instructions.InitCMOSInstructions()
+	}
+}
+
+// Adds the instructions the 65C02 adds to, or redefines in, the 6502
+// CPU's instruction set to the InstructionTable.  InitInstructions
+// should be called first.
+func (instructions *InstructionTable) InitCMOSInstructions() {
+	var insts []Instruction
+
+	// JMP
+
+	//     Indirect
+	insts = append(insts, Instruction{
+		Mneumonic: "JMP",
+		OpCode:    0x6c,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 6
+			cpu.Jmp(cpu.indirectAddress())
+			return
+		}})
+
+	// BRA
+
+	//     Relative
+	insts = append(insts, Instruction{
+		Mneumonic: "BRA",
+		OpCode:    0x80,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 2
+			cpu.Bra(cpu.relativeAddress(), &cycles)
+			return
+		}})
+
+	// PHX
+
+	//     Implied
+	insts = append(insts, Instruction{
+		Mneumonic: "PHX",
+		OpCode:    0xda,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 3
+			cpu.Phx()
+			return
+		}})
+
+	// PHY
+
+	//     Implied
+	insts = append(insts, Instruction{
+		Mneumonic: "PHY",
+		OpCode:    0x5a,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 3
+			cpu.Phy()
+			return
+		}})
+
+	// PLX
+
+	//     Implied
+	insts = append(insts, Instruction{
+		Mneumonic: "PLX",
+		OpCode:    0xfa,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 4
+			cpu.Plx()
+			return
+		}})
+
+	// PLY
+
+	//     Implied
+	insts = append(insts, Instruction{
+		Mneumonic: "PLY",
+		OpCode:    0x7a,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 4
+			cpu.Ply()
+			return
+		}})
+
+	// STZ
+
+	//     Zero Page
+	insts = append(insts, Instruction{
+		Mneumonic: "STZ",
+		OpCode:    0x64,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 3
+			cpu.Stz(cpu.zeroPageAddress())
+			return
+		}})
+
+	//     Zero Page,X
+	insts = append(insts, Instruction{
+		Mneumonic: "STZ",
+		OpCode:    0x74,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 4
+			cpu.Stz(cpu.zeroPageIndexedAddress(X))
+			return
+		}})
+
+	//     Absolute
+	insts = append(insts, Instruction{
+		Mneumonic: "STZ",
+		OpCode:    0x9c,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 4
+			cpu.Stz(cpu.absoluteAddress())
+			return
+		}})
+
+	//     Absolute,X
+	insts = append(insts, Instruction{
+		Mneumonic: "STZ",
+		OpCode:    0x9e,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			cycles = 5
+			cpu.Stz(cpu.absoluteIndexedAddress(X, nil))
+			return
+		}})
+
+	instructions.AddAll(describe(insts, &cmosOpcodes))
+}
+
+// Returns an instruction for each of the given opcodes, all sharing
+// the same Exec function.  Rather than capturing its opcode, 'exec'
+// finds the addressing mode and cycles of the opcode being executed
+// in the Instruction it is passed, so a single function value serves
+// every addressing mode of an instruction.
+func group(mneumonic string, ops []OpCode, exec func(cpu *M6502, inst *Instruction) (cycles uint16)) []Instruction {
+	insts := make([]Instruction, len(ops))
+
+	for i, opcode := range ops {
+		insts[i] = Instruction{Mneumonic: mneumonic, OpCode: opcode, Exec: exec}
+	}
+
+	return insts
+}
+
+// Fills in the metadata of each instruction from its entry in 'table'
+// and returns 'insts'.
+func describe(insts []Instruction, table *[256]opcodeInfo) []Instruction {
+	for i := range insts {
+		info := table[insts[i].OpCode]
+
+		insts[i].mode = info.mode
+		insts[i].size = 1 + info.mode.OperandSize()
+		insts[i].cycles = info.cycles
+		insts[i].pageCross = info.pageCross
+		insts[i].illegal = info.mnemonic != "" && info.mnemonic[0] == '*'
+	}
+
+	return insts
 }
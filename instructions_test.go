@@ -1,6 +1,10 @@
 package m65go2
 
-import "testing"
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
 
 var cpu *M6502
 
@@ -14,6 +18,57 @@ func Teardown() {
 
 }
 
+// Describes the cycles an opcode takes without and with crossing a
+// page boundary.
+type opCodeCycles struct {
+	opcode      OpCode
+	cycles      uint16
+	crossCycles uint16
+}
+
+// Executes each opcode and checks that it is dispatched to an
+// instruction with the given mnemonic and takes the expected number of
+// cycles, first with X and Y set to 0 and then with X and Y set to 1
+// so that the indexed addressing modes cross a page boundary.
+func testOpCodeCycles(t *testing.T, mneumonic string, cases []opCodeCycles) {
+	for _, c := range cases {
+		for _, index := range []uint8{0, 1} {
+			Setup()
+
+			cpu.EnableIllegalOpcodes()
+
+			cpu.Registers.X = index
+			cpu.Registers.Y = index
+			cpu.Registers.PC = 0x0100
+
+			cpu.Memory.Store(0x0100, uint8(c.opcode))
+			cpu.Memory.Store(0x0101, 0xff)
+			cpu.Memory.Store(0x0102, 0x02)
+
+			cpu.Memory.Store(0x00ff, 0xff) // ($ff),Y points to 0x02ff
+			cpu.Memory.Store(0x0000, 0x02)
+
+			if inst, ok := cpu.Instructions.Lookup(c.opcode); !ok || inst.Mneumonic != mneumonic {
+				t.Errorf("Opcode %#02x is not %s\n", c.opcode, mneumonic)
+			}
+
+			cycles, _ := cpu.Execute()
+
+			expected := c.cycles
+
+			if index != 0 {
+				expected = c.crossCycles
+			}
+
+			if cycles != expected {
+				t.Errorf("Opcode %#02x: cycles is %d, not %d\n", c.opcode, cycles, expected)
+			}
+
+			Teardown()
+		}
+	}
+}
+
 // BadOpCodeError
 
 func TestBadOpCodeError(t *testing.T) {
@@ -36,6 +91,297 @@ func TestBadOpCodeError(t *testing.T) {
 	Teardown()
 }
 
+// InstructionTable
+
+func TestInstructionTableShared(t *testing.T) {
+	Setup()
+
+	table := cpu.Instructions
+	table.RemoveInstruction(0xa9)
+
+	if _, ok := cpu.Instructions.Lookup(0xa9); ok {
+		t.Error("Removing from a copy of the table did not affect the CPU's table")
+	}
+
+	var empty InstructionTable
+
+	if _, ok := empty.Lookup(0xa9); ok {
+		t.Error("Zero InstructionTable holds an instruction")
+	}
+
+	empty.RemoveInstruction(0xa9)
+	empty.AddInstruction(Instruction{
+		Mneumonic: "LDA",
+		OpCode:    0xa9,
+		Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+			return 2
+		}})
+
+	if _, ok := empty.Lookup(0xa9); !ok {
+		t.Error("Instruction added to a zero InstructionTable is missing")
+	}
+
+	Teardown()
+}
+
+// RemoveInstruction
+
+func TestRemoveInstruction(t *testing.T) {
+	Setup()
+
+	lda, ok := cpu.Instructions.Lookup(0xa9)
+
+	if !ok {
+		t.Error("Opcode 0xa9 is not defined")
+	}
+
+	cpu.Instructions.RemoveInstruction(0xa9)
+
+	if _, ok := cpu.Instructions.Lookup(0xa9); ok {
+		t.Error("Opcode 0xa9 is still defined")
+	}
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9)
+	cpu.Memory.Store(0x0101, 0xff)
+
+	if _, err := cpu.Execute(); err != BadOpCodeError(0xa9) {
+		t.Error("Did not receive expected error type BadOpCodeError")
+	}
+
+	if cpu.Registers.PC != 0x0100 {
+		t.Error("Register PC is not 0x0100")
+	}
+
+	cpu.Instructions.AddInstruction(lda)
+
+	if _, err := cpu.Execute(); err != nil {
+		t.Error("Error during Execute")
+	}
+
+	if cpu.Registers.A != 0xff {
+		t.Error("Register A is not 0xff")
+	}
+
+	// opcodes never added are missing even with undocumented opcodes
+	// enabled
+	cpu.EnableIllegalOpcodes()
+
+	for _, op := range []OpCode{0x82, 0xc2, 0xe2} {
+		if _, ok := cpu.Instructions.Lookup(op); ok {
+			t.Errorf("Opcode %#02x is defined\n", op)
+		}
+
+		if _, err := cpu.ExecuteOpcode(op); err != BadOpCodeError(op) {
+			t.Errorf("Opcode %#02x did not return BadOpCodeError\n", op)
+		}
+	}
+
+	Teardown()
+}
+
+// AddAll
+
+func TestAddAll(t *testing.T) {
+	Setup()
+
+	var executed []OpCode
+
+	insts := []Instruction{}
+
+	for _, o := range []OpCode{0x02, 0x12, 0x22} {
+		opcode := o
+
+		insts = append(insts, Instruction{
+			Mneumonic: "*TST",
+			OpCode:    opcode,
+			Exec: func(cpu *M6502, inst *Instruction) (cycles uint16) {
+				executed = append(executed, opcode)
+				return 2
+			}})
+	}
+
+	cpu.Instructions.AddAll(insts)
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x02)
+	cpu.Memory.Store(0x0101, 0x12)
+	cpu.Memory.Store(0x0102, 0x22)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cpu.Execute(); err != nil {
+			t.Errorf("Error during Execute: %s\n", err)
+		}
+	}
+
+	if len(executed) != 3 || executed[0] != 0x02 || executed[1] != 0x12 || executed[2] != 0x22 {
+		t.Error("Added instructions were not dispatched")
+	}
+
+	Teardown()
+}
+
+func TestInstructionMetadata(t *testing.T) {
+	Setup()
+
+	for _, c := range []struct {
+		opcode   OpCode
+		mnemonic string
+		mode     AddressingMode
+		size     uint8
+		cycles   uint8
+	}{
+		{0xa9, "LDA", Immediate, 2, 2},
+		{0xbd, "LDA", AbsoluteX, 3, 4},
+		{0x0a, "ASL", Accumulator, 1, 2},
+		{0x6c, "JMP", Indirect, 3, 5},
+		{0xb1, "LDA", IndirectIndexed, 2, 5},
+		{0x91, "STA", IndirectIndexed, 2, 6},
+		{0x87, "*SAX", ZeroPage, 2, 3},
+		{0xd0, "BNE", Relative, 2, 2},
+		{0x00, "BRK", Implied, 1, 7},
+	} {
+		inst, ok := cpu.Instructions.Lookup(c.opcode)
+
+		if !ok {
+			t.Errorf("Opcode %#02x is not defined\n", c.opcode)
+			continue
+		}
+
+		if inst.Mnemonic() != c.mnemonic {
+			t.Errorf("Opcode %#02x: Mnemonic is %s, not %s\n", c.opcode, inst.Mnemonic(), c.mnemonic)
+		}
+
+		if inst.Mode() != c.mode {
+			t.Errorf("Opcode %#02x: Mode is %d, not %d\n", c.opcode, inst.Mode(), c.mode)
+		}
+
+		if inst.Size() != c.size {
+			t.Errorf("Opcode %#02x: Size is %d, not %d\n", c.opcode, inst.Size(), c.size)
+		}
+
+		if inst.Cycles() != c.cycles {
+			t.Errorf("Opcode %#02x: Cycles is %d, not %d\n", c.opcode, inst.Cycles(), c.cycles)
+		}
+	}
+
+	Teardown()
+}
+
+func TestInstructionExec(t *testing.T) {
+	for _, variant := range []Variant{NMOS6502, CMOS65C02} {
+		Setup()
+
+		cpu.SetVariant(variant)
+
+		for op := 0; op < 256; op++ {
+			opcode := OpCode(op)
+			inst, ok := cpu.Instructions.Lookup(opcode)
+
+			if !ok || inst.Mode() == Relative {
+				continue
+			}
+
+			switch inst.Mneumonic {
+			case "BRK", "JMP", "JSR", "RTI", "RTS":
+				continue
+			}
+
+			Teardown()
+			Setup()
+
+			cpu.SetVariant(variant)
+			cpu.EnableIllegalOpcodes()
+
+			cpu.Registers.PC = 0x0200
+
+			cpu.Memory.Store(0x0200, uint8(opcode))
+			cpu.Memory.Store(0x0201, 0x10)
+			cpu.Memory.Store(0x0202, 0x00)
+
+			cpu.Memory.Store(0x0010, 0x00) // ($10) points to 0x0300
+			cpu.Memory.Store(0x0011, 0x03)
+
+			cycles, err := cpu.Execute()
+
+			if err != nil {
+				t.Errorf("Opcode %#02x: error during Execute: %s\n", opcode, err)
+			}
+
+			if cpu.Registers.PC != 0x0200+uint16(inst.Size()) {
+				t.Errorf("Opcode %#02x: register PC is %#04x, not %#04x\n", opcode, cpu.Registers.PC, 0x0200+uint16(inst.Size()))
+			}
+
+			if cycles != uint16(inst.Cycles()) {
+				t.Errorf("Opcode %#02x: cycles is %d, not %d\n", opcode, cycles, inst.Cycles())
+			}
+		}
+
+		Teardown()
+	}
+}
+
+func TestInstructionExecReregistered(t *testing.T) {
+	Setup()
+
+	lda, _ := cpu.Instructions.Lookup(0xa9)
+
+	// registered under an opcode of another addressing mode, Exec
+	// still loads an immediate operand
+	lda.OpCode = 0xad
+	cpu.Instructions.AddInstruction(lda)
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xad)
+	cpu.Memory.Store(0x0101, 0x84)
+
+	cycles, _ := cpu.Execute()
+
+	if cpu.Registers.A != 0x84 || cpu.Registers.PC != 0x0102 || cycles != 2 {
+		t.Error("Re-registered LDA did not load its immediate operand in 2 cycles")
+	}
+
+	// called directly, with PC at its operand, Exec does not depend
+	// on the last executed opcode
+	cpu.Registers.PC = 0x0101
+
+	cpu.Memory.Store(0x0101, 0x42)
+
+	cycles = lda.Exec(cpu, &lda)
+
+	if cpu.Registers.A != 0x42 || cpu.Registers.PC != 0x0102 || cycles != 2 {
+		t.Error("Calling LDA's Exec directly did not load its immediate operand in 2 cycles")
+	}
+
+	Teardown()
+}
+
+func TestInitInstructionsAllocs(t *testing.T) {
+	allocs := testing.AllocsPerRun(10, func() {
+		instructions := NewInstructionTable()
+		instructions.InitInstructions()
+	})
+
+	// a closure per opcode would take well over 100
+	if allocs > 16 {
+		t.Errorf("InitInstructions made %.0f allocations, not at most 16\n", allocs)
+	}
+}
+
+// Opcodes that share an Exec function share a single function value,
+// so InitInstructions allocates only its instruction slices and table.
+func BenchmarkInitInstructions(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		instructions := NewInstructionTable()
+		instructions.InitInstructions()
+	}
+}
+
 // LDA
 
 func TestLdaImmediate(t *testing.T) {
@@ -55,6 +401,44 @@ func TestLdaImmediate(t *testing.T) {
 	Teardown()
 }
 
+func TestLdaImmediateDoesNotDereference(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa9)
+	cpu.Memory.Store(0x0101, 0x84)
+	cpu.Memory.Store(0x0084, 0xff)
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0x84 {
+		t.Error("Register A is not 0x84")
+	}
+
+	if cpu.Registers.PC != 0x0102 {
+		t.Error("Register PC is not 0x0102")
+	}
+
+	Teardown()
+
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa5)
+	cpu.Memory.Store(0x0101, 0x84)
+	cpu.Memory.Store(0x0084, 0xff)
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0xff {
+		t.Error("Register A is not 0xff")
+	}
+
+	Teardown()
+}
+
 func TestLdaZeroPage(t *testing.T) {
 	Setup()
 
@@ -111,6 +495,29 @@ func TestLdaAbsolute(t *testing.T) {
 	Teardown()
 }
 
+func TestLdaAbsoluteWrap(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0xfffe
+
+	cpu.Memory.Store(0xfffe, 0xad)
+	cpu.Memory.Store(0xffff, 0x84)
+	cpu.Memory.Store(0x0000, 0x02)
+	cpu.Memory.Store(0x0284, 0xff)
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0xff {
+		t.Error("Register A is not 0xff")
+	}
+
+	if cpu.Registers.PC != 0x0001 {
+		t.Error("Register PC is not 0x0001")
+	}
+
+	Teardown()
+}
+
 func TestLdaAbsoluteX(t *testing.T) {
 	Setup()
 
@@ -782,6 +1189,18 @@ func TestStaIndirectY(t *testing.T) {
 	Teardown()
 }
 
+func TestStaCycles(t *testing.T) {
+	testOpCodeCycles(t, "STA", []opCodeCycles{
+		{0x85, 3, 3}, // zero page
+		{0x95, 4, 4}, // zero page,X
+		{0x8d, 4, 4}, // absolute
+		{0x9d, 5, 5}, // absolute,X
+		{0x99, 5, 5}, // absolute,Y
+		{0x81, 6, 6}, // (indirect,X)
+		{0x91, 6, 6}, // (indirect),Y
+	})
+}
+
 // STX
 
 func TestStxZeroPage(t *testing.T) {
@@ -898,6 +1317,71 @@ func TestStyAbsolute(t *testing.T) {
 	Teardown()
 }
 
+// STZ
+
+func TestStz(t *testing.T) {
+	Setup()
+
+	cpu.SetVariant(CMOS65C02)
+
+	for _, c := range []struct {
+		code    []uint8
+		address uint16
+		cycles  uint16
+	}{
+		{[]uint8{0x64, 0x84}, 0x0084, 3},       // STZ $84
+		{[]uint8{0x74, 0x84}, 0x0085, 4},       // STZ $84,X
+		{[]uint8{0x9c, 0x84, 0x02}, 0x0284, 4}, // STZ $0284
+		{[]uint8{0x9e, 0xff, 0x02}, 0x0300, 5}, // STZ $02ff,X
+	} {
+		cpu.Registers = Registers{A: 0xaa, X: 0x01, Y: 0xbb, P: N | C | U, SP: 0xfd, PC: 0x0100}
+		saved := cpu.Registers
+
+		for i, b := range c.code {
+			cpu.Memory.Store(0x0100+uint16(i), b)
+		}
+
+		cpu.Memory.Store(c.address, 0xff)
+
+		cycles, err := cpu.Execute()
+
+		if err != nil {
+			t.Errorf("Opcode %#02x: Error during Execute\n", c.code[0])
+		}
+
+		if cpu.Memory.Fetch(c.address) != 0x00 {
+			t.Errorf("Opcode %#02x: Memory at %#04x is not 0x00\n", c.code[0], c.address)
+		}
+
+		if cycles != c.cycles {
+			t.Errorf("Opcode %#02x: Cycles is %d, not %d\n", c.code[0], cycles, c.cycles)
+		}
+
+		saved.PC += uint16(len(c.code))
+
+		if cpu.Registers != saved {
+			t.Errorf("Opcode %#02x: Registers are %+v, not %+v\n", c.code[0], cpu.Registers, saved)
+		}
+	}
+
+	// on the NMOS 6502, 0x64 is not STZ
+	cpu.SetVariant(NMOS6502)
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x64)
+	cpu.Memory.Store(0x0101, 0x84)
+	cpu.Memory.Store(0x0084, 0xff)
+
+	cpu.Execute()
+
+	if cpu.Memory.Fetch(0x0084) != 0xff {
+		t.Error("Opcode 0x64 stored zero on the NMOS 6502")
+	}
+
+	Teardown()
+}
+
 // TAX
 
 func TestTax(t *testing.T) {
@@ -1118,26 +1602,61 @@ func TestPhp(t *testing.T) {
 	Teardown()
 }
 
-// PLA
-
-func TestPla(t *testing.T) {
+func TestPhpPushesBAndUnused(t *testing.T) {
 	Setup()
 
+	cpu.DisableUnusedBitForcing()
+
+	cpu.Registers.P = C
 	cpu.Registers.PC = 0x0100
-	cpu.push(0xff)
 
-	cpu.Memory.Store(0x0100, 0x68)
+	cpu.Memory.Store(0x0100, 0x08) // PHP
+	cpu.Memory.Store(0x0101, 0x68) // PLA
+	cpu.Memory.Store(0x0102, 0x00) // BRK
+	cpu.Memory.Store(0xfffe, 0x00)
+	cpu.Memory.Store(0xffff, 0x02)
 
+	cpu.Execute()
 	cpu.Execute()
 
-	if cpu.Registers.A != 0xff {
-		t.Error("Memory is not 0xff")
+	if cpu.Registers.A&uint8(B|U) != uint8(B|U) {
+		t.Error("Bits 4 and 5 are not both set after PHP")
+	}
+
+	if cpu.Registers.A != uint8(C|B|U) {
+		t.Error("Register A is not 0x31")
+	}
+
+	cpu.Registers.P = C
+	cpu.Execute()
+
+	if cpu.pull() != uint8(C|B|U) {
+		t.Error("Bits 4 and 5 are not both set after BRK")
 	}
 
 	Teardown()
 }
 
-func TestPlaZFlagSet(t *testing.T) {
+// PLA
+
+func TestPla(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+	cpu.push(0xff)
+
+	cpu.Memory.Store(0x0100, 0x68)
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0xff {
+		t.Error("Memory is not 0xff")
+	}
+
+	Teardown()
+}
+
+func TestPlaZFlagSet(t *testing.T) {
 	Setup()
 
 	cpu.push(0x00)
@@ -1205,6 +1724,67 @@ func TestPlaNFlagUnset(t *testing.T) {
 	Teardown()
 }
 
+// PHX, PHY, PLX and PLY
+
+func TestPhxPhyPlxPly(t *testing.T) {
+	Setup()
+
+	cpu.SetVariant(CMOS65C02)
+
+	cpu.Registers.X = 0x80
+	cpu.Registers.Y = 0x00
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xda) // PHX
+	cpu.Memory.Store(0x0101, 0x5a) // PHY
+	cpu.Memory.Store(0x0102, 0xfa) // PLX
+	cpu.Memory.Store(0x0103, 0x7a) // PLY
+
+	cpu.Execute()
+	cpu.Execute()
+
+	if cpu.Registers.SP != 0xfb {
+		t.Error("Register SP is not 0xfb")
+	}
+
+	if cpu.Memory.Fetch(0x01fd) != 0x80 || cpu.Memory.Fetch(0x01fc) != 0x00 {
+		t.Error("X and Y were not pushed")
+	}
+
+	cpu.Registers.X = 0x42
+	cpu.Registers.Y = 0x42
+
+	// X receives Y's old value
+	if cycles, _ := cpu.Execute(); cycles != 4 {
+		t.Error("Cycles is not 4")
+	}
+
+	if cpu.Registers.X != 0x00 {
+		t.Error("Register X is not 0x00")
+	}
+
+	if cpu.Registers.P&Z == 0 || cpu.Registers.P&N != 0 {
+		t.Error("Flags are not Z after PLX")
+	}
+
+	// Y receives X's old value
+	cpu.Execute()
+
+	if cpu.Registers.Y != 0x80 {
+		t.Error("Register Y is not 0x80")
+	}
+
+	if cpu.Registers.P&Z != 0 || cpu.Registers.P&N == 0 {
+		t.Error("Flags are not N after PLY")
+	}
+
+	if cpu.Registers.SP != 0xfd {
+		t.Error("Register SP is not 0xfd")
+	}
+
+	Teardown()
+}
+
 // PLP
 
 func TestPlp(t *testing.T) {
@@ -1224,6 +1804,42 @@ func TestPlp(t *testing.T) {
 	Teardown()
 }
 
+func TestPlpPhpRoundTrip(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+	cpu.push(uint8(N | C)) // B and bit 5 clear
+
+	cpu.Memory.Store(0x0100, 0x28) // PLP
+	cpu.Memory.Store(0x0101, 0x08) // PHP
+
+	cpu.Execute()
+
+	if cpu.Registers.P != N|U|C {
+		t.Error("Status is not 0xa1 after PLP")
+	}
+
+	cpu.Execute()
+
+	if cpu.pull() != uint8(N|B|U|C) {
+		t.Error("Memory is not 0xb1 after PHP")
+	}
+
+	cpu.Registers.PC = 0x0200
+	cpu.push16(0x0300)
+	cpu.push(uint8(V | B)) // B set, bit 5 clear
+
+	cpu.Memory.Store(0x0200, 0x40) // RTI
+
+	cpu.Execute()
+
+	if cpu.Registers.P != V|U {
+		t.Error("Status is not 0x60 after RTI")
+	}
+
+	Teardown()
+}
+
 // AND
 
 func TestAndImmediate(t *testing.T) {
@@ -2084,6 +2700,78 @@ func TestBitZFlagUnset(t *testing.T) {
 	Teardown()
 }
 
+func TestBitClearsStaleNVFlags(t *testing.T) {
+	Setup()
+
+	cpu.Registers.P |= N | V
+	cpu.Registers.A = 0xff
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x24)
+	cpu.Memory.Store(0x0101, 0x84)
+	cpu.Memory.Store(0x0084, 0x00)
+
+	cpu.Execute()
+
+	if cpu.Registers.P&N != 0 {
+		t.Error("N flag is set")
+	}
+
+	if cpu.Registers.P&V != 0 {
+		t.Error("V flag is set")
+	}
+
+	Teardown()
+}
+
+func TestBitCycles(t *testing.T) {
+	testOpCodeCycles(t, "BIT", []opCodeCycles{
+		{0x24, 3, 3}, // zero page
+		{0x2c, 4, 4}, // absolute
+	})
+}
+
+func TestBitCopiesFlags(t *testing.T) {
+	Setup()
+
+	cpu.Registers.A = 0x3f
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x2c)
+	cpu.Memory.Store(0x0101, 0x02)
+	cpu.Memory.Store(0x0102, 0x20)
+	cpu.Memory.Store(0x2002, 0xc0)
+
+	cpu.Execute()
+
+	if cpu.Registers.P&N == 0 {
+		t.Error("N flag is not set")
+	}
+
+	if cpu.Registers.P&V == 0 {
+		t.Error("V flag is not set")
+	}
+
+	if cpu.Registers.P&Z == 0 {
+		t.Error("Z flag is not set")
+	}
+
+	if cpu.Registers.A != 0x3f {
+		t.Error("Register A is not 0x3f")
+	}
+
+	cpu.Registers.A = 0x40
+	cpu.Registers.PC = 0x0100
+
+	cpu.Execute()
+
+	if cpu.Registers.P&Z != 0 {
+		t.Error("Z flag is set")
+	}
+
+	Teardown()
+}
+
 // ADC
 
 func TestAdcImmediate(t *testing.T) {
@@ -2484,6 +3172,19 @@ func TestAdcNFlagUnset(t *testing.T) {
 	Teardown()
 }
 
+func TestAdcCycles(t *testing.T) {
+	testOpCodeCycles(t, "ADC", []opCodeCycles{
+		{0x69, 2, 2}, // immediate
+		{0x65, 3, 3}, // zero page
+		{0x75, 4, 4}, // zero page,X
+		{0x6d, 4, 4}, // absolute
+		{0x7d, 4, 5}, // absolute,X
+		{0x79, 4, 5}, // absolute,Y
+		{0x61, 6, 6}, // (indirect,X)
+		{0x71, 5, 6}, // (indirect),Y
+	})
+}
+
 // SBC
 
 func TestSbcImmediate(t *testing.T) {
@@ -2814,6 +3515,153 @@ func TestSbcNFlagUnset(t *testing.T) {
 	Teardown()
 }
 
+func TestSbcCycles(t *testing.T) {
+	testOpCodeCycles(t, "SBC", []opCodeCycles{
+		{0xe9, 2, 2}, // immediate
+		{0xe5, 3, 3}, // zero page
+		{0xf5, 4, 4}, // zero page,X
+		{0xed, 4, 4}, // absolute
+		{0xfd, 4, 5}, // absolute,X
+		{0xf9, 4, 5}, // absolute,Y
+		{0xe1, 6, 6}, // (indirect,X)
+		{0xf1, 5, 6}, // (indirect),Y
+	})
+}
+
+func TestSbcImmediateFlags(t *testing.T) {
+	Setup()
+
+	cpu.Registers.P |= C
+	cpu.Registers.A = 0x50
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xe9)
+	cpu.Memory.Store(0x0101, 0xb0)
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0xa0 {
+		t.Error("Register A is not 0xa0")
+	}
+
+	if cpu.Registers.P&C != 0 {
+		t.Error("C flag is set")
+	}
+
+	if cpu.Registers.P&Z != 0 {
+		t.Error("Z flag is set")
+	}
+
+	if cpu.Registers.P&V == 0 {
+		t.Error("V flag is not set")
+	}
+
+	if cpu.Registers.P&N == 0 {
+		t.Error("N flag is not set")
+	}
+
+	cpu.Registers.P |= C
+	cpu.Registers.A = 0x42
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0101, 0x42)
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0x00 {
+		t.Error("Register A is not 0x00")
+	}
+
+	if cpu.Registers.P&C == 0 {
+		t.Error("C flag is not set")
+	}
+
+	if cpu.Registers.P&Z == 0 {
+		t.Error("Z flag is not set")
+	}
+
+	if cpu.Registers.P&V != 0 {
+		t.Error("V flag is set")
+	}
+
+	if cpu.Registers.P&N != 0 {
+		t.Error("N flag is set")
+	}
+
+	Teardown()
+}
+
+func TestDecimalMode(t *testing.T) {
+	Setup()
+
+	type vector struct {
+		a, operand uint8
+		c          bool
+		result     uint8
+		flags      Status // expected C, Z, V and N
+	}
+
+	for _, c := range []struct {
+		opcode  OpCode
+		vectors []vector
+	}{
+		{0x69, []vector{ // ADC
+			{0x00, 0x00, false, 0x00, Z},
+			{0x12, 0x34, false, 0x46, 0},
+			{0x79, 0x00, true, 0x80, V | N},
+			{0x24, 0x56, false, 0x80, V | N},
+			{0x93, 0x82, false, 0x75, C | V},
+			{0x89, 0x76, false, 0x65, C},
+			{0x89, 0x76, true, 0x66, C | Z},  // Z from the binary sum 0x100
+			{0x99, 0x01, false, 0x00, C | N}, // Z from the binary sum 0x9a
+			{0x2f, 0x4f, false, 0x74, 0},     // invalid BCD
+			{0x80, 0xf0, false, 0xd0, C | V},
+			{0x80, 0xfa, false, 0xe0, C | N},
+			{0x0f, 0x0a, false, 0x1f, 0},
+		}},
+		{0xe9, []vector{ // SBC
+			{0x00, 0x00, true, 0x00, C | Z},
+			{0x00, 0x01, true, 0x99, N},
+			{0x46, 0x12, true, 0x34, C},
+			{0x40, 0x13, true, 0x27, C},
+			{0x32, 0x02, false, 0x29, C},
+			{0x21, 0x34, true, 0x87, N},
+			{0x80, 0x01, true, 0x79, C | V},
+			{0x0a, 0x00, true, 0x0a, C},      // invalid BCD
+			{0x0b, 0x00, false, 0x0a, C},     // invalid BCD
+			{0x9a, 0x00, true, 0x9a, C | N},  // invalid BCD
+			{0x9b, 0x00, false, 0x9a, C | N}, // invalid BCD
+		}},
+	} {
+		for _, v := range c.vectors {
+			cpu.Registers.P = D | U
+			cpu.Registers.A = v.a
+			cpu.Registers.PC = 0x0100
+
+			if v.c {
+				cpu.Registers.P |= C
+			}
+
+			cpu.Memory.Store(0x0100, uint8(c.opcode))
+			cpu.Memory.Store(0x0101, v.operand)
+
+			cpu.Execute()
+
+			if cpu.Registers.A != v.result {
+				t.Errorf("Opcode %#02x: %#02x, %#02x, C=%v: Register A is %#02x, not %#02x\n",
+					c.opcode, v.a, v.operand, v.c, cpu.Registers.A, v.result)
+			}
+
+			if flags := cpu.Registers.P & (C | Z | V | N); flags != v.flags {
+				t.Errorf("Opcode %#02x: %#02x, %#02x, C=%v: Flags are %s, not %s\n",
+					c.opcode, v.a, v.operand, v.c, flags, v.flags)
+			}
+		}
+	}
+
+	Teardown()
+}
+
 // CMP
 
 func TestCmpImmediate(t *testing.T) {
@@ -3481,6 +4329,73 @@ func TestCpyCFlagUnset(t *testing.T) {
 	Teardown()
 }
 
+func TestCompareCycles(t *testing.T) {
+	testOpCodeCycles(t, "CMP", []opCodeCycles{
+		{0xc9, 2, 2}, // immediate
+		{0xc5, 3, 3}, // zero page
+		{0xd5, 4, 4}, // zero page,X
+		{0xcd, 4, 4}, // absolute
+		{0xdd, 4, 5}, // absolute,X
+		{0xd9, 4, 5}, // absolute,Y
+		{0xc1, 6, 6}, // (indirect,X)
+		{0xd1, 5, 6}, // (indirect),Y
+	})
+
+	testOpCodeCycles(t, "CPX", []opCodeCycles{
+		{0xe0, 2, 2}, // immediate
+		{0xe4, 3, 3}, // zero page
+		{0xec, 4, 4}, // absolute
+	})
+
+	testOpCodeCycles(t, "CPY", []opCodeCycles{
+		{0xc0, 2, 2}, // immediate
+		{0xc4, 3, 3}, // zero page
+		{0xcc, 4, 4}, // absolute
+	})
+}
+
+func TestCompareFlags(t *testing.T) {
+	comparisons := []struct {
+		register uint8
+		operand  uint8
+		c, z, n  bool
+	}{
+		{0x40, 0x40, true, true, false},  // equal
+		{0x41, 0x40, true, false, false}, // greater
+		{0x40, 0x41, false, false, true}, // lesser
+	}
+
+	for _, opcode := range []OpCode{0xc9, 0xe0, 0xc0} {
+		for _, c := range comparisons {
+			Setup()
+
+			cpu.Registers.A = c.register
+			cpu.Registers.X = c.register
+			cpu.Registers.Y = c.register
+			cpu.Registers.PC = 0x0100
+
+			cpu.Memory.Store(0x0100, uint8(opcode))
+			cpu.Memory.Store(0x0101, c.operand)
+
+			cpu.Execute()
+
+			if (cpu.Registers.P&C != 0) != c.c {
+				t.Errorf("Opcode %#02x: %#02x vs %#02x: C flag is not %v\n", opcode, c.register, c.operand, c.c)
+			}
+
+			if (cpu.Registers.P&Z != 0) != c.z {
+				t.Errorf("Opcode %#02x: %#02x vs %#02x: Z flag is not %v\n", opcode, c.register, c.operand, c.z)
+			}
+
+			if (cpu.Registers.P&N != 0) != c.n {
+				t.Errorf("Opcode %#02x: %#02x vs %#02x: N flag is not %v\n", opcode, c.register, c.operand, c.n)
+			}
+
+			Teardown()
+		}
+	}
+}
+
 // INC
 
 func TestIncZeroPage(t *testing.T) {
@@ -3718,6 +4633,42 @@ func TestInxNFlagUnset(t *testing.T) {
 	Teardown()
 }
 
+func TestInxWraparound(t *testing.T) {
+	Setup()
+
+	cpu.Registers.X = 0xff
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xe8)
+
+	cycles, _ := cpu.Execute()
+
+	if cpu.Registers.X != 0x00 {
+		t.Error("Register X is not 0x00")
+	}
+
+	if cpu.Registers.P&Z == 0 {
+		t.Error("Z flag is not set")
+	}
+
+	if cpu.Registers.P&N != 0 {
+		t.Error("N flag is set")
+	}
+
+	if cycles != 2 {
+		t.Error("Cycles is not 2")
+	}
+
+	Teardown()
+}
+
+func TestIncrementDecrementRegisterCycles(t *testing.T) {
+	testOpCodeCycles(t, "INX", []opCodeCycles{{0xe8, 2, 2}})
+	testOpCodeCycles(t, "INY", []opCodeCycles{{0xc8, 2, 2}})
+	testOpCodeCycles(t, "DEX", []opCodeCycles{{0xca, 2, 2}})
+	testOpCodeCycles(t, "DEY", []opCodeCycles{{0x88, 2, 2}})
+}
+
 // INY
 
 func TestIny(t *testing.T) {
@@ -4509,21 +5460,76 @@ func TestLsrNFlagUnset(t *testing.T) {
 	Teardown()
 }
 
-// ROL
+func TestShiftCycles(t *testing.T) {
+	testOpCodeCycles(t, "ASL", []opCodeCycles{
+		{0x0a, 2, 2}, // accumulator
+		{0x06, 5, 5}, // zero page
+		{0x16, 6, 6}, // zero page,X
+		{0x0e, 6, 6}, // absolute
+		{0x1e, 7, 7}, // absolute,X
+	})
 
-func TestRolAccumulator(t *testing.T) {
+	testOpCodeCycles(t, "LSR", []opCodeCycles{
+		{0x4a, 2, 2}, // accumulator
+		{0x46, 5, 5}, // zero page
+		{0x56, 6, 6}, // zero page,X
+		{0x4e, 6, 6}, // absolute
+		{0x5e, 7, 7}, // absolute,X
+	})
+}
+
+func TestAslCarry(t *testing.T) {
 	Setup()
 
-	cpu.Registers.P |= C
-	cpu.Registers.A = 0x2
+	cpu.Registers.A = 0x81
 	cpu.Registers.PC = 0x0100
 
-	cpu.Memory.Store(0x0100, 0x2a)
+	cpu.Memory.Store(0x0100, 0x0a)
 
 	cpu.Execute()
 
-	if cpu.Registers.A != 0x05 {
-		t.Error("Register A is not 0x05")
+	if cpu.Registers.A != 0x02 {
+		t.Error("Register A is not 0x02")
+	}
+
+	if cpu.Registers.P&C == 0 {
+		t.Error("C flag is not set")
+	}
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x06)
+	cpu.Memory.Store(0x0101, 0x84)
+	cpu.Memory.Store(0x0084, 0x81)
+
+	cpu.Execute()
+
+	if cpu.Memory.Fetch(0x0084) != 0x02 {
+		t.Error("Memory is not 0x02")
+	}
+
+	if cpu.Registers.P&C == 0 {
+		t.Error("C flag is not set")
+	}
+
+	Teardown()
+}
+
+// ROL
+
+func TestRolAccumulator(t *testing.T) {
+	Setup()
+
+	cpu.Registers.P |= C
+	cpu.Registers.A = 0x2
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x2a)
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0x05 {
+		t.Error("Register A is not 0x05")
 	}
 
 	Teardown()
@@ -4915,6 +5921,85 @@ func TestRorNFlagUnset(t *testing.T) {
 	Teardown()
 }
 
+func TestRotateCycles(t *testing.T) {
+	testOpCodeCycles(t, "ROL", []opCodeCycles{
+		{0x2a, 2, 2}, // accumulator
+		{0x26, 5, 5}, // zero page
+		{0x36, 6, 6}, // zero page,X
+		{0x2e, 6, 6}, // absolute
+		{0x3e, 7, 7}, // absolute,X
+	})
+
+	testOpCodeCycles(t, "ROR", []opCodeCycles{
+		{0x6a, 2, 2}, // accumulator
+		{0x66, 5, 5}, // zero page
+		{0x76, 6, 6}, // zero page,X
+		{0x6e, 6, 6}, // absolute
+		{0x7e, 7, 7}, // absolute,X
+	})
+}
+
+func TestRotateThroughCarry(t *testing.T) {
+	Setup()
+
+	cpu.Registers.P |= C
+	cpu.Registers.A = 0x40
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x2a) // ROL A
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0x81 {
+		t.Error("Register A is not 0x81 after ROL")
+	}
+
+	if cpu.Registers.P&C != 0 {
+		t.Error("C flag is set after ROL")
+	}
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0x02 {
+		t.Error("Register A is not 0x02 after second ROL")
+	}
+
+	if cpu.Registers.P&C == 0 {
+		t.Error("C flag is not set after second ROL")
+	}
+
+	cpu.Registers.A = 0x02
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x6a) // ROR A
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0x81 {
+		t.Error("Register A is not 0x81 after ROR")
+	}
+
+	if cpu.Registers.P&C != 0 {
+		t.Error("C flag is set after ROR")
+	}
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0x40 {
+		t.Error("Register A is not 0x40 after second ROR")
+	}
+
+	if cpu.Registers.P&C == 0 {
+		t.Error("C flag is not set after second ROR")
+	}
+
+	Teardown()
+}
+
 // JMP
 
 func TestJmpAbsolute(t *testing.T) {
@@ -4955,6 +6040,68 @@ func TestJmpIndirect(t *testing.T) {
 	Teardown()
 }
 
+func TestJmpIndirectPageBug(t *testing.T) {
+	for _, c := range []struct {
+		variant Variant
+		pc      uint16
+		cycles  uint16
+	}{
+		{NMOS6502, 0x1234, 5},  // high byte read from 0x0200
+		{CMOS65C02, 0x5634, 6}, // high byte read from 0x0300
+	} {
+		cpu = NewM6502WithVariant(NewBasicMemory(DEFAULT_MEMORY_SIZE), nil, c.variant)
+		cpu.Reset()
+
+		if cpu.Variant() != c.variant {
+			t.Errorf("Variant is %d, not %d\n", cpu.Variant(), c.variant)
+		}
+
+		cpu.Registers.PC = 0x0100
+
+		cpu.Memory.Store(0x0100, 0x6c) // JMP ($02ff)
+		cpu.Memory.Store(0x0101, 0xff)
+		cpu.Memory.Store(0x0102, 0x02)
+		cpu.Memory.Store(0x02ff, 0x34)
+		cpu.Memory.Store(0x0200, 0x12)
+		cpu.Memory.Store(0x0300, 0x56)
+
+		cycles, _ := cpu.Execute()
+
+		if cpu.Registers.PC != c.pc {
+			t.Errorf("Variant %d: Register PC is %#04x, not %#04x\n", c.variant, cpu.Registers.PC, c.pc)
+		}
+
+		if cycles != c.cycles {
+			t.Errorf("Variant %d: Cycles is %d, not %d\n", c.variant, cycles, c.cycles)
+		}
+	}
+}
+
+func TestBrkDecimalFlag(t *testing.T) {
+	for _, c := range []struct {
+		variant Variant
+		d       bool
+	}{{NMOS6502, true}, {CMOS65C02, false}} {
+		cpu = NewM6502WithVariant(NewBasicMemory(DEFAULT_MEMORY_SIZE), nil, c.variant)
+		cpu.Reset()
+
+		cpu.Registers.P |= D
+		cpu.Registers.PC = 0x0100
+
+		cpu.Memory.Store(0x0100, 0x00) // BRK
+
+		cpu.Execute()
+
+		if (cpu.Registers.P&D != 0) != c.d {
+			t.Errorf("Variant %d: D flag is not %v after BRK\n", c.variant, c.d)
+		}
+
+		if cpu.pull()&uint8(D) == 0 {
+			t.Errorf("Variant %d: Pushed D flag is not set\n", c.variant)
+		}
+	}
+}
+
 // JSR
 
 func TestJsr(t *testing.T) {
@@ -5324,6 +6471,125 @@ func TestBvs(t *testing.T) {
 	Teardown()
 }
 
+func TestBranchCycles(t *testing.T) {
+	branches := []struct {
+		opcode OpCode
+		flag   Status
+		set    bool // branch is taken when flag is set
+	}{
+		{0x10, N, false}, // BPL
+		{0x30, N, true},  // BMI
+		{0x50, V, false}, // BVC
+		{0x70, V, true},  // BVS
+		{0x90, C, false}, // BCC
+		{0xb0, C, true},  // BCS
+		{0xd0, Z, false}, // BNE
+		{0xf0, Z, true},  // BEQ
+	}
+
+	for _, b := range branches {
+		for _, c := range []struct {
+			taken  bool
+			offset uint8
+			pc     uint16
+			cycles uint16
+		}{
+			{false, 0x10, 0x0152, 2}, // not taken
+			{true, 0x10, 0x0162, 3},  // taken, same page
+			{true, 0xa0, 0x00f2, 4},  // taken, crosses a page
+		} {
+			Setup()
+
+			cpu.Registers.PC = 0x0150
+
+			if c.taken == b.set {
+				cpu.Registers.P |= b.flag
+			} else {
+				cpu.Registers.P &^= b.flag
+			}
+
+			cpu.Memory.Store(0x0150, uint8(b.opcode))
+			cpu.Memory.Store(0x0151, c.offset)
+
+			cycles, _ := cpu.Execute()
+
+			if cpu.Registers.PC != c.pc {
+				t.Errorf("Opcode %#02x: register PC is %#04x, not %#04x\n", b.opcode, cpu.Registers.PC, c.pc)
+			}
+
+			if cycles != c.cycles {
+				t.Errorf("Opcode %#02x: cycles is %d, not %d\n", b.opcode, cycles, c.cycles)
+			}
+
+			Teardown()
+		}
+	}
+}
+
+// BRA
+
+func TestBra(t *testing.T) {
+	Setup()
+
+	cpu.SetVariant(CMOS65C02)
+
+	cpu.Registers.P = N | Z | C | V | U
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x80)
+	cpu.Memory.Store(0x0101, 0x02) // +2
+
+	cycles, err := cpu.Execute()
+
+	if err != nil {
+		t.Error("Error during Execute")
+	}
+
+	if cpu.Registers.PC != 0x0104 {
+		t.Error("Register PC is not 0x0104")
+	}
+
+	if cycles != 3 {
+		t.Errorf("Cycles is %d, not 3\n", cycles)
+	}
+
+	cpu.Registers.P = U
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0101, 0xfc) // -4, crosses into page 0x00
+
+	cycles, _ = cpu.Execute()
+
+	if cpu.Registers.PC != 0x00fe {
+		t.Error("Register PC is not 0x00fe")
+	}
+
+	if cycles != 4 {
+		t.Errorf("Cycles is %d, not 4\n", cycles)
+	}
+
+	// on the NMOS 6502, 0x80 is not BRA
+	cpu.SetVariant(NMOS6502)
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0101, 0x02)
+
+	if _, err = cpu.Execute(); err != BadOpCodeError(0x80) {
+		t.Error("Opcode 0x80 did not return BadOpCodeError on the NMOS 6502")
+	}
+
+	cpu.EnableIllegalOpcodes()
+
+	cpu.Execute()
+
+	if cpu.Registers.PC != 0x0102 {
+		t.Error("Opcode 0x80 branched on the NMOS 6502")
+	}
+
+	Teardown()
+}
+
 // CLC
 
 func TestClc(t *testing.T) {
@@ -5563,6 +6829,52 @@ func TestBrk(t *testing.T) {
 	Teardown()
 }
 
+func TestBrkRti(t *testing.T) {
+	Setup()
+
+	cpu.Registers.P = C | Z | U
+	cpu.Registers.PC = 0x0200
+
+	cpu.Memory.Store(0x0200, 0x00) // BRK
+	cpu.Memory.Store(0x0300, 0x40) // RTI
+	cpu.Memory.Store(0xfffe, 0x00)
+	cpu.Memory.Store(0xffff, 0x03)
+
+	cycles, _ := cpu.Execute()
+
+	if cycles != 7 {
+		t.Error("BRK cycles is not 7")
+	}
+
+	if cpu.Registers.PC != 0x0300 {
+		t.Error("Register PC is not 0x0300")
+	}
+
+	if cpu.Registers.P&I == 0 {
+		t.Error("I flag is not set")
+	}
+
+	if cpu.Memory.Fetch(cpu.StackAddr()+1) != uint8(C|Z|B|U) {
+		t.Error("Pushed status is not 0x33")
+	}
+
+	cycles, _ = cpu.Execute()
+
+	if cycles != 6 {
+		t.Error("RTI cycles is not 6")
+	}
+
+	if cpu.Registers.PC != 0x0202 {
+		t.Error("Register PC is not 0x0202")
+	}
+
+	if cpu.Registers.P != C|Z|U {
+		t.Error("Register P is not 0x23")
+	}
+
+	Teardown()
+}
+
 // RTI
 
 func TestRti(t *testing.T) {
@@ -5587,12 +6899,373 @@ func TestRti(t *testing.T) {
 	Teardown()
 }
 
+// Zero page indirect wrap
+
+func TestZeroPageIndirectWrap(t *testing.T) {
+	for _, opcode := range []OpCode{0xa1, 0xb1} { // LDA ($ff,X), LDA ($ff),Y
+		Setup()
+
+		cpu.Registers.PC = 0x0100
+
+		cpu.Memory.Store(0x0100, uint8(opcode))
+		cpu.Memory.Store(0x0101, 0xff)
+
+		cpu.Memory.Store(0x00ff, 0x34) // low byte
+		cpu.Memory.Store(0x0000, 0x12) // high byte, wrapped
+
+		cpu.Memory.Store(0x1234, 0x42)
+
+		cpu.Execute()
+
+		if cpu.Registers.A != 0x42 {
+			t.Errorf("Opcode %#02x: register A is %#02x, not 0x42\n", opcode, cpu.Registers.A)
+		}
+
+		Teardown()
+	}
+}
+
+// NOP
+
+func TestNop(t *testing.T) {
+	Setup()
+
+	cpu.Registers.A = 0x42
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xea)
+
+	registers := cpu.Registers
+
+	cycles, _ := cpu.Execute()
+
+	if cycles != 2 {
+		t.Error("Cycles is not 2")
+	}
+
+	if cpu.Registers.PC != 0x0101 {
+		t.Error("Register PC is not 0x0101")
+	}
+
+	registers.PC = 0x0101
+	registers.P |= U
+
+	if cpu.Registers != registers {
+		t.Error("Registers other than PC changed")
+	}
+
+	var buf bytes.Buffer
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.StepTrace(&buf)
+
+	if !strings.HasPrefix(buf.String(), "0100  EA        NOP ") {
+		t.Errorf("Trace line is %q\n", buf.String())
+	}
+
+	Teardown()
+}
+
+// Unofficial NOP
+
+func TestNopUnofficial(t *testing.T) {
+	nops := []struct {
+		opcode OpCode
+		size   uint16
+		cycles uint16
+	}{
+		{0x1a, 1, 2}, // implied
+		{0x80, 2, 2}, // immediate
+		{0x04, 2, 3}, // zero page
+		{0x14, 2, 4}, // zero page,X
+		{0x0c, 3, 4}, // absolute
+		{0x1c, 3, 4}, // absolute,X
+	}
+
+	for _, nop := range nops {
+		Setup()
+
+		cpu.EnableIllegalOpcodes()
+
+		cpu.Registers.A = 0x42
+		cpu.Registers.X = 0x01
+		cpu.Registers.PC = 0x0100
+
+		cpu.Memory.Store(0x0100, uint8(nop.opcode))
+		cpu.Memory.Store(0x0101, 0x10)
+		cpu.Memory.Store(0x0102, 0x02)
+
+		cycles, err := cpu.Execute()
+
+		if err != nil {
+			t.Errorf("Opcode %#02x: error during Execute: %s\n", nop.opcode, err)
+		}
+
+		if cycles != nop.cycles {
+			t.Errorf("Opcode %#02x: cycles is %d, not %d\n", nop.opcode, cycles, nop.cycles)
+		}
+
+		if cpu.Registers.PC != 0x0100+nop.size {
+			t.Errorf("Opcode %#02x: register PC is %#04x, not %#04x\n", nop.opcode, cpu.Registers.PC, 0x0100+nop.size)
+		}
+
+		if cpu.Registers.A != 0x42 || cpu.Registers.P != I|U {
+			t.Errorf("Opcode %#02x: registers changed\n", nop.opcode)
+		}
+
+		Teardown()
+	}
+}
+
+func TestNopAbsoluteXPageCross(t *testing.T) {
+	Setup()
+
+	cpu.EnableIllegalOpcodes()
+
+	cpu.Registers.X = 0x01
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0x1c)
+	cpu.Memory.Store(0x0101, 0xff)
+	cpu.Memory.Store(0x0102, 0x02)
+
+	cycles, _ := cpu.Execute()
+
+	if cycles != 5 {
+		t.Error("Cycles is not 5")
+	}
+
+	if cpu.Registers.PC != 0x0103 {
+		t.Error("Register PC is not 0x0103")
+	}
+
+	Teardown()
+}
+
 // Rom
 
+func TestLaxCycles(t *testing.T) {
+	testOpCodeCycles(t, "*LAX", []opCodeCycles{
+		{0xa7, 3, 3}, // zero page
+		{0xb7, 4, 4}, // zero page,Y
+		{0xaf, 4, 4}, // absolute
+		{0xbf, 4, 5}, // absolute,Y
+		{0xa3, 6, 6}, // (indirect,X)
+		{0xb3, 5, 6}, // (indirect),Y
+	})
+}
+
+func TestSaxCycles(t *testing.T) {
+	testOpCodeCycles(t, "*SAX", []opCodeCycles{
+		{0x87, 3, 3}, // zero page
+		{0x97, 4, 4}, // zero page,Y
+		{0x8f, 4, 4}, // absolute
+		{0x83, 6, 6}, // (indirect,X)
+	})
+}
+
+func TestSloCycles(t *testing.T) {
+	testOpCodeCycles(t, "*SLO", []opCodeCycles{
+		{0x07, 5, 5}, // zero page
+		{0x17, 6, 6}, // zero page,X
+		{0x0f, 6, 6}, // absolute
+		{0x1f, 7, 7}, // absolute,X
+		{0x1b, 7, 7}, // absolute,Y
+		{0x03, 8, 8}, // (indirect,X)
+		{0x13, 8, 8}, // (indirect),Y
+	})
+}
+
+func TestIllegalOpcodes(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xa7) // LAX $84
+	cpu.Memory.Store(0x0101, 0x84)
+	cpu.Memory.Store(0x0084, 0xff)
+
+	if _, err := cpu.Execute(); err != BadOpCodeError(0xa7) {
+		t.Error("Opcode 0xa7 did not return BadOpCodeError")
+	}
+
+	if cpu.Registers.PC != 0x0100 {
+		t.Error("Register PC is not 0x0100")
+	}
+
+	cpu.EnableIllegalOpcodes()
+
+	cpu.Execute()
+
+	if cpu.Registers.A != 0xff {
+		t.Error("Register A is not 0xff")
+	}
+
+	if cpu.Registers.X != 0xff {
+		t.Error("Register X is not 0xff")
+	}
+
+	if cpu.Registers.P&N == 0 {
+		t.Error("N flag is not set")
+	}
+
+	// SAX
+	cpu.Registers.A = 0xf0
+	cpu.Registers.X = 0x3c
+
+	cpu.Memory.Store(0x0102, 0x87) // SAX $84
+	cpu.Memory.Store(0x0103, 0x84)
+
+	cpu.Execute()
+
+	if cpu.Memory.Fetch(0x0084) != 0x30 {
+		t.Error("Memory is not 0x30")
+	}
+
+	// DCP
+	cpu.Registers.A = 0x2f
+
+	cpu.Memory.Store(0x0104, 0xc7) // DCP $84
+	cpu.Memory.Store(0x0105, 0x84)
+
+	cpu.Execute()
+
+	if cpu.Memory.Fetch(0x0084) != 0x2f {
+		t.Error("Memory is not 0x2f")
+	}
+
+	if cpu.Registers.P&(Z|C) != Z|C {
+		t.Error("Z and C flags are not set")
+	}
+
+	// ISB
+	cpu.Registers.A = 0x40
+	cpu.Registers.P |= C
+
+	cpu.Memory.Store(0x0106, 0xe7) // ISB $84
+	cpu.Memory.Store(0x0107, 0x84)
+
+	cpu.Execute()
+
+	if cpu.Memory.Fetch(0x0084) != 0x30 {
+		t.Error("Memory is not 0x30")
+	}
+
+	if cpu.Registers.A != 0x10 {
+		t.Error("Register A is not 0x10")
+	}
+
+	cpu.DisableIllegalOpcodes()
+
+	cpu.Registers.PC = 0x0100
+
+	if _, err := cpu.Execute(); err != BadOpCodeError(0xa7) {
+		t.Error("Opcode 0xa7 did not return BadOpCodeError")
+	}
+
+	// the 65C02 has no LAX, even with undocumented opcodes enabled
+	cpu.SetVariant(CMOS65C02)
+	cpu.EnableIllegalOpcodes()
+
+	cpu.Registers.A = 0x00
+	cpu.Registers.X = 0x00
+
+	cpu.Memory.Store(0x0084, 0x55)
+
+	if _, err := cpu.Execute(); err != BadOpCodeError(0xa7) {
+		t.Error("Opcode 0xa7 did not return BadOpCodeError on the 65C02")
+	}
+
+	if cpu.Registers.A != 0x00 || cpu.Registers.X != 0x00 {
+		t.Error("Opcode 0xa7 executed LAX on the 65C02")
+	}
+
+	Teardown()
+}
+
+func TestKil(t *testing.T) {
+	Setup()
+
+	cpu.Registers.PC = 0x0100
+
+	cpu.Memory.Store(0x0100, 0xea) // NOP
+	cpu.Memory.Store(0x0101, 0x02) // KIL
+
+	if _, err := cpu.ExecuteOpcode(0x02); err != BadOpCodeError(0x02) {
+		t.Error("Opcode 0x02 did not return BadOpCodeError")
+	}
+
+	cpu.EnableIllegalOpcodes()
+
+	if err := cpu.Run(); err != CPUJammedError(0x0101) {
+		t.Errorf("Run returned %v, not CPUJammedError\n", err)
+	}
+
+	if cpu.Registers.PC != 0x0101 {
+		t.Error("Register PC is not 0x0101")
+	}
+
+	if !cpu.Halted() {
+		t.Error("CPU is not halted")
+	}
+
+	cpu.Irq = true
+	cpu.Nmi = true
+
+	if _, err := cpu.Execute(); err != CPUJammedError(0x0101) {
+		t.Error("Did not receive expected error type CPUJammedError")
+	}
+
+	if cpu.Registers.PC != 0x0101 {
+		t.Error("Register PC is not 0x0101")
+	}
+
+	cpu.Irq = false
+	cpu.Nmi = false
+
+	cpu.Memory.Store(0xfffc, 0x00)
+	cpu.Memory.Store(0xfffd, 0x01)
+
+	if _, err := cpu.ExecuteOpcode(0xea); err != CPUJammedError(0x0101) {
+		t.Error("ExecuteOpcode did not return CPUJammedError")
+	}
+
+	cpu.PerformRst()
+
+	if cpu.Halted() {
+		t.Error("CPU is halted after reset")
+	}
+
+	if _, err := cpu.Execute(); err != nil {
+		t.Error("Error during Execute")
+	}
+
+	if cpu.Registers.PC != 0x0101 {
+		t.Error("Register PC is not 0x0101")
+	}
+
+	// the 65C02 has no KIL opcodes
+	cpu.SetVariant(CMOS65C02)
+
+	cpu.Registers.PC = 0x0101
+
+	if _, err := cpu.Execute(); err != BadOpCodeError(0x02) {
+		t.Error("Opcode 0x02 did not return BadOpCodeError on the 65C02")
+	}
+
+	if cpu.Halted() {
+		t.Error("Opcode 0x02 jammed the 65C02")
+	}
+
+	Teardown()
+}
+
 func TestRom(t *testing.T) {
 	Setup()
 
 	cpu.DisableDecimalMode()
+	cpu.EnableIllegalOpcodes()
 
 	cpu.Registers.P = 0x24
 	cpu.Registers.SP = 0xfd
@@ -5641,8 +7314,8 @@ func TestIrq(t *testing.T) {
 
 	cpu.PerformInterrupts()
 
-	if cpu.pull() != 0xfb {
-		t.Error("Memory is not 0xfb")
+	if cpu.pull() != 0xeb {
+		t.Error("Memory is not 0xeb")
 	}
 
 	if cpu.pull16() != 0x0100 {
@@ -5674,8 +7347,8 @@ func TestNmi(t *testing.T) {
 
 	cpu.PerformInterrupts()
 
-	if cpu.pull() != 0xff {
-		t.Error("Memory is not 0xff")
+	if cpu.pull() != 0xef {
+		t.Error("Memory is not 0xef")
 	}
 
 	if cpu.pull16() != 0x0100 {
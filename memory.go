@@ -1,8 +1,11 @@
 package m65go2
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"strings"
 )
 
 const (
@@ -18,11 +21,61 @@ type Memory interface {
 	Store(address uint16, value uint8) (oldValue uint8) // Stores the value at the given memory address
 }
 
+// Represents the contents of RAM at power on.  Real RAM chips do not
+// power on zeroed, and some programs behave differently depending on
+// the pattern they power on with.
+type PowerOnPattern uint8
+
+const (
+	PowerOnZero        PowerOnPattern = iota // all bytes are 0x00
+	PowerOnFF                                // all bytes are 0xff
+	PowerOnAlternating                       // 0x00, 0xff, 0x00, 0xff, ...
+	PowerOnFamicom                           // 0x00 x4, 0xff x4, 0x00 x4, ...
+)
+
+// Returns the byte stored at the given address at power on when using
+// the pattern.
+func (pattern PowerOnPattern) Byte(address uint32) uint8 {
+	switch pattern {
+	case PowerOnFF:
+		return 0xff
+	case PowerOnAlternating:
+		if address&0x01 != 0 {
+			return 0xff
+		}
+	case PowerOnFamicom:
+		if address&0x04 != 0 {
+			return 0xff
+		}
+	}
+
+	return 0x00
+}
+
+// Returns the 16-bit little-endian value stored at 'address' and
+// 'address' + 1 in 'mem'.  The high byte is read from 0x0000 if
+// 'address' is 0xffff.
+func Fetch16(mem Memory, address uint16) uint16 {
+	low := mem.Fetch(address)
+	high := mem.Fetch(address + 1)
+
+	return (uint16(high) << 8) | uint16(low)
+}
+
+// Stores 'value' in 'mem' in little-endian order, the low byte at
+// 'address' and the high byte at 'address' + 1.
+func Store16(mem Memory, address uint16, value uint16) {
+	mem.Store(address, uint8(value))
+	mem.Store(address+1, uint8(value>>8))
+}
+
 // Represents the 6502 CPU's memory using a static array of uint8's.
 type BasicMemory struct {
 	m             []uint8
 	disableReads  bool
 	disableWrites bool
+	readOnly      [][2]uint16
+	pattern       PowerOnPattern
 }
 
 // Returns a pointer to a new BasicMemory with all memory initialized
@@ -49,6 +102,23 @@ func (mem *BasicMemory) EnableWrites() {
 	mem.disableWrites = false
 }
 
+// Marks the addresses between 'start' and 'end' inclusive as read
+// only, as the ROM on a cartridge is.  Stores to a read only address
+// are silently ignored while reads are unaffected.
+func (mem *BasicMemory) SetReadOnly(start, end uint16) {
+	mem.readOnly = append(mem.readOnly, [2]uint16{start, end})
+}
+
+func (mem *BasicMemory) isReadOnly(address uint16) bool {
+	for _, r := range mem.readOnly {
+		if address >= r[0] && address <= r[1] {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Resets all memory locations to zero
 func (mem *BasicMemory) Reset() {
 	for i := range mem.m {
@@ -56,6 +126,93 @@ func (mem *BasicMemory) Reset() {
 	}
 }
 
+// Sets the pattern memory is filled with by PowerOn.  The default
+// pattern is PowerOnZero.
+func (mem *BasicMemory) SetPowerOnPattern(pattern PowerOnPattern) {
+	mem.pattern = pattern
+}
+
+// Fills all memory locations with the power on pattern
+func (mem *BasicMemory) PowerOn() {
+	for i := range mem.m {
+		mem.m[i] = mem.pattern.Byte(uint32(i))
+	}
+}
+
+// Stores 'value' at every address between 'start' and 'end'
+// inclusive.  Does nothing if 'start' is greater than 'end'.
+func (mem *BasicMemory) Fill(start, end uint16, value uint8) {
+	if start > end {
+		return
+	}
+
+	for address := uint32(start); address <= uint32(end); address++ {
+		mem.Store(uint16(address), value)
+	}
+}
+
+// Copies 'data' into memory starting at 'address'.  Data which
+// extends past 0xffff wraps around to 0x0000, just as the CPU's
+// addresses do.  Writes are made even if they have been disabled with
+// DisableWrites or SetReadOnly, so Load can be used to set up ROM
+// images.
+func (mem *BasicMemory) Load(address uint16, data []byte) {
+	for i, b := range data {
+		mem.m[address+uint16(i)] = b
+	}
+}
+
+// Reads the file at 'path' and loads its contents into memory
+// starting at 'address' as Load does.  Returns an error if the file
+// cannot be read or if its contents would extend past 0xffff, in
+// which case memory is left unchanged.
+func (mem *BasicMemory) LoadFile(path string, address uint16) error {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	if int(address)+len(data) > 0x10000 {
+		return fmt.Errorf("%s: %d bytes at $%04X extend past $FFFF", path, len(data), address)
+	}
+
+	mem.Load(address, data)
+
+	return nil
+}
+
+// Returns a copy of the bytes stored at the addresses between 'start'
+// and 'end' inclusive, or nil if 'start' is greater than 'end'.
+func (mem *BasicMemory) DumpRange(start, end uint16) []byte {
+	if start > end {
+		return nil
+	}
+
+	return append([]byte(nil), mem.m[start:uint32(end)+1]...)
+}
+
+// Returns the bytes stored at the addresses between 'start' and 'end'
+// inclusive formatted 16 bytes per line, each line prefixed with the
+// address of its first byte, e.g. '0400: 20 20 20 ...'.
+func (mem *BasicMemory) Hexdump(start, end uint16) string {
+	var lines []string
+
+	data := mem.DumpRange(start, end)
+
+	for i := 0; i < len(data); i += 16 {
+		line := fmt.Sprintf("%04X:", int(start)+i)
+
+		for j := i; j < i+16 && j < len(data); j++ {
+			line += fmt.Sprintf(" %02X", data[j])
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 // Returns the value stored at the given memory address
 func (mem *BasicMemory) Fetch(address uint16) (value uint8) {
 	if mem.disableReads {
@@ -67,9 +224,21 @@ func (mem *BasicMemory) Fetch(address uint16) (value uint8) {
 	return
 }
 
+// Returns the 16-bit little-endian value stored at the given memory
+// address
+func (mem *BasicMemory) Fetch16(address uint16) uint16 {
+	return Fetch16(mem, address)
+}
+
+// Stores the 16-bit value at the given memory address in
+// little-endian order
+func (mem *BasicMemory) Store16(address uint16, value uint16) {
+	Store16(mem, address, value)
+}
+
 // Stores the value at the given memory address
 func (mem *BasicMemory) Store(address uint16, value uint8) (oldValue uint8) {
-	if !mem.disableWrites {
+	if !mem.disableWrites && !mem.isReadOnly(address) {
 		oldValue = mem.m[address]
 		mem.m[address] = value
 	}
@@ -125,6 +294,351 @@ func (mem *BasicMemory) load(path string) {
 	return
 }
 
+// Represents a Memory decorator which records the address and value
+// of the most recent read and write made through it.  This is useful
+// for modeling open-bus behavior, where a read from an unmapped
+// address returns the last value seen on the data bus, and for
+// debuggers.
+type TrackingMemory struct {
+	Memory         Memory // the decorated Memory
+	LastReadAddr   uint16 // address of the most recent Fetch
+	LastReadValue  uint8  // value returned by the most recent Fetch
+	LastWriteAddr  uint16 // address of the most recent Store
+	LastWriteValue uint8  // value written by the most recent Store
+}
+
+// Returns a pointer to a new TrackingMemory which decorates 'mem'.
+func NewTrackingMemory(mem Memory) *TrackingMemory {
+	return &TrackingMemory{Memory: mem}
+}
+
+// Resets the decorated Memory
+func (mem *TrackingMemory) Reset() {
+	mem.Memory.Reset()
+}
+
+// Returns the value stored at the given memory address and records
+// the access
+func (mem *TrackingMemory) Fetch(address uint16) (value uint8) {
+	value = mem.Memory.Fetch(address)
+	mem.LastReadAddr = address
+	mem.LastReadValue = value
+	return
+}
+
+// Stores the value at the given memory address and records the
+// access
+func (mem *TrackingMemory) Store(address uint16, value uint8) (oldValue uint8) {
+	oldValue = mem.Memory.Store(address, value)
+	mem.LastWriteAddr = address
+	mem.LastWriteValue = value
+	return
+}
+
+// Represents a Memory decorator which mirrors a region of the
+// decorated Memory.  Addresses between 'start' and 'mirrorEnd' are
+// folded into the 'size' bytes beginning at 'start', so that on the
+// NES, for example, a write to 0x0000 is also visible at 0x0800,
+// 0x1000 and 0x1800.  Other addresses are passed through unchanged.
+type MirroredMemory struct {
+	Memory    Memory // the decorated Memory
+	start     uint16
+	size      uint16
+	mirrorEnd uint16
+}
+
+// Returns a pointer to a new MirroredMemory which mirrors the 'size'
+// bytes of 'base' beginning at 'start' up to and including
+// 'mirrorEnd'.
+func NewMirroredMemory(base Memory, start, size, mirrorEnd uint16) *MirroredMemory {
+	return &MirroredMemory{
+		Memory:    base,
+		start:     start,
+		size:      size,
+		mirrorEnd: mirrorEnd,
+	}
+}
+
+func (mem *MirroredMemory) fold(address uint16) uint16 {
+	if mem.size != 0 && address >= mem.start && address <= mem.mirrorEnd {
+		return mem.start + (address-mem.start)%mem.size
+	}
+
+	return address
+}
+
+// Resets the decorated Memory
+func (mem *MirroredMemory) Reset() {
+	mem.Memory.Reset()
+}
+
+// Returns the value stored at the given memory address, after folding
+// it into the mirrored region
+func (mem *MirroredMemory) Fetch(address uint16) (value uint8) {
+	return mem.Memory.Fetch(mem.fold(address))
+}
+
+// Stores the value at the given memory address, after folding it into
+// the mirrored region
+func (mem *MirroredMemory) Store(address uint16, value uint8) (oldValue uint8) {
+	return mem.Memory.Store(mem.fold(address), value)
+}
+
+// Flags controlling access to a page of a MappedMemory.
+const (
+	pageRead uint8 = 1 << iota
+	pageWrite
+	pageExecute
+)
+
+// Error types used to indicate an access to a page of a MappedMemory
+// whose flags do not allow it.  The value is the address accessed.
+type ReadProtectionError uint16
+type WriteProtectionError uint16
+type ExecuteProtectionError uint16
+
+func (e ReadProtectionError) Error() string {
+	return fmt.Sprintf("Read from non-readable address $%04X", uint16(e))
+}
+
+func (e WriteProtectionError) Error() string {
+	return fmt.Sprintf("Write to non-writable address $%04X", uint16(e))
+}
+
+func (e ExecuteProtectionError) Error() string {
+	return fmt.Sprintf("Execute from non-executable address $%04X", uint16(e))
+}
+
+// Implemented by Memory types which restrict access to their
+// contents.  The CPU only executes opcodes from executable addresses
+// and halts with the error returned by violation() once an
+// instruction completes.
+type protectedMemory interface {
+	executable(address uint16) bool
+	violation() error
+}
+
+// Represents a Memory decorator which traps accesses to individual
+// addresses, for emulating memory-mapped I/O, and controls read,
+// write and execute access for each 256-byte page of the decorated
+// Memory.  Reads and writes of an address with a registered hook are
+// passed to the hook instead of the decorated Memory, while
+// watchpoints merely observe them.  All pages are initially readable,
+// writable and executable.  Reads from a non-readable page return 0xff
+// and writes to a non-writable page are ignored.  In strict mode, any
+// such access also causes the CPU to halt with a ReadProtectionError,
+// WriteProtectionError or ExecuteProtectionError.  Note that the CPU
+// reads the operands of an instruction from memory, so executable
+// pages should normally also be readable.
+type MappedMemory struct {
+	Memory Memory // the decorated Memory
+	reads  map[uint16]func(address uint16) uint8
+	writes map[uint16]func(address uint16, value uint8)
+	rwatch map[uint16]func(value uint8)
+	wwatch map[uint16]func(old, new uint8)
+	flags  [256]uint8
+	strict bool
+	fault  error
+}
+
+// Returns a pointer to a new MappedMemory which decorates 'mem'.
+func NewMappedMemory(mem Memory) *MappedMemory {
+	mapped := &MappedMemory{
+		Memory: mem,
+		reads:  make(map[uint16]func(address uint16) uint8),
+		writes: make(map[uint16]func(address uint16, value uint8)),
+		rwatch: make(map[uint16]func(value uint8)),
+		wwatch: make(map[uint16]func(old, new uint8)),
+	}
+
+	for i := range mapped.flags {
+		mapped.flags[i] = pageRead | pageWrite | pageExecute
+	}
+
+	return mapped
+}
+
+// Registers a function to be called instead of reading the decorated
+// Memory whenever 'addr' is read.  The value it returns is the value
+// read.  Passing nil removes any previously registered function.
+func (mem *MappedMemory) ReadHook(addr uint16, fn func(address uint16) uint8) {
+	if fn == nil {
+		delete(mem.reads, addr)
+	} else {
+		mem.reads[addr] = fn
+	}
+}
+
+// Registers a function to be called instead of writing the decorated
+// Memory whenever 'addr' is written.  Passing nil removes any
+// previously registered function.
+func (mem *MappedMemory) WriteHook(addr uint16, fn func(address uint16, value uint8)) {
+	if fn == nil {
+		delete(mem.writes, addr)
+	} else {
+		mem.writes[addr] = fn
+	}
+}
+
+// Registers a function to be called with the value read whenever
+// 'addr' is read.  Unlike a read hook, the function only observes the
+// read.  Passing nil removes any previously registered function.
+func (mem *MappedMemory) WatchRead(addr uint16, fn func(value uint8)) {
+	if fn == nil {
+		delete(mem.rwatch, addr)
+	} else {
+		mem.rwatch[addr] = fn
+	}
+}
+
+// Registers a function to be called with the old value returned by
+// the decorated Memory's Store, or 0 if a write hook handled the
+// write, and the value written whenever 'addr' is written.  Unlike a
+// write hook, the function only observes the write, and it never
+// reads the decorated Memory itself.  Passing nil removes any
+// previously registered function.
+func (mem *MappedMemory) WatchWrite(addr uint16, fn func(old, new uint8)) {
+	if fn == nil {
+		delete(mem.wwatch, addr)
+	} else {
+		mem.wwatch[addr] = fn
+	}
+}
+
+// Sets whether the given page may be read from, written to and
+// executed from.
+func (mem *MappedMemory) SetPageFlags(page uint8, r, w, x bool) {
+	var flags uint8
+
+	if r {
+		flags |= pageRead
+	}
+
+	if w {
+		flags |= pageWrite
+	}
+
+	if x {
+		flags |= pageExecute
+	}
+
+	mem.flags[page] = flags
+}
+
+// Returns whether the given page may be read from, written to and
+// executed from.
+func (mem *MappedMemory) PageFlags(page uint8) (r, w, x bool) {
+	flags := mem.flags[page]
+	return flags&pageRead != 0, flags&pageWrite != 0, flags&pageExecute != 0
+}
+
+// Causes accesses violating a page's flags to halt the CPU with an
+// error.
+func (mem *MappedMemory) EnableStrict() {
+	mem.strict = true
+}
+
+// Disables strict mode after a call to EnableStrict.
+func (mem *MappedMemory) DisableStrict() {
+	mem.strict = false
+}
+
+// Resets the decorated Memory
+func (mem *MappedMemory) Reset() {
+	mem.Memory.Reset()
+}
+
+// Returns the value stored at the given memory address, or returned by
+// its read hook, or 0xff if the address's page is not readable
+func (mem *MappedMemory) Fetch(address uint16) (value uint8) {
+	if mem.flags[address>>8]&pageRead == 0 {
+		mem.protect(ReadProtectionError(address))
+		return 0xff
+	}
+
+	if fn, ok := mem.reads[address]; ok {
+		value = fn(address)
+	} else {
+		value = mem.Memory.Fetch(address)
+	}
+
+	if fn, ok := mem.rwatch[address]; ok {
+		fn(value)
+	}
+
+	return
+}
+
+// Stores the value at the given memory address, or passes it to its
+// write hook, unless the address's page is not writable
+func (mem *MappedMemory) Store(address uint16, value uint8) (oldValue uint8) {
+	if mem.flags[address>>8]&pageWrite == 0 {
+		mem.protect(WriteProtectionError(address))
+		return
+	}
+
+	if fn, ok := mem.writes[address]; ok {
+		fn(address, value)
+	} else {
+		oldValue = mem.Memory.Store(address, value)
+	}
+
+	if fn, ok := mem.wwatch[address]; ok {
+		fn(oldValue, value)
+	}
+
+	return
+}
+
+func (mem *MappedMemory) protect(err error) {
+	if mem.strict && mem.fault == nil {
+		mem.fault = err
+	}
+}
+
+func (mem *MappedMemory) executable(address uint16) bool {
+	return !mem.strict || mem.flags[address>>8]&pageExecute != 0
+}
+
+// Returns and clears the first access violation since the last call.
+func (mem *MappedMemory) violation() (err error) {
+	err, mem.fault = mem.fault, nil
+	return
+}
+
+// Returns the string stored at 'addr', reading bytes until a zero byte
+// or until 'maxLen' bytes have been read.  Reads past 0xffff wrap
+// around to 0x0000.
+func ReadString(mem Memory, addr uint16, maxLen int) string {
+	buf := make([]byte, 0, maxLen)
+
+	for i := 0; i < maxLen; i++ {
+		b := mem.Fetch(addr + uint16(i))
+
+		if b == 0x00 {
+			break
+		}
+
+		buf = append(buf, b)
+	}
+
+	return string(buf)
+}
+
+// Returns the string stored at 'addr' whose length is given by the
+// byte stored at 'addr', with the string itself starting at the
+// following address.  Reads past 0xffff wrap around to 0x0000.
+func ReadLengthPrefixedString(mem Memory, addr uint16) string {
+	n := mem.Fetch(addr)
+	buf := make([]byte, n)
+
+	for i := range buf {
+		buf[i] = mem.Fetch(addr + 1 + uint16(i))
+	}
+
+	return string(buf)
+}
+
 // Returns true iff the two addresses are located in the same page in
 // memory.  Two addresses are on the same page if their high bytes are
 // both the same, i.e. 0x0101 and 0x0103 are on the same page but
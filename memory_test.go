@@ -1,6 +1,9 @@
 package m65go2
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -23,3 +26,450 @@ func TestSamePage(t *testing.T) {
 		}
 	}
 }
+
+func TestTrackingMemory(t *testing.T) {
+	mem := NewTrackingMemory(NewBasicMemory(DEFAULT_MEMORY_SIZE))
+
+	mem.Store(0x0200, 0xab)
+
+	if mem.LastWriteAddr != 0x0200 || mem.LastWriteValue != 0xab {
+		t.Error("Last write is not 0xab at 0x0200")
+	}
+
+	mem.Memory.Store(0x0300, 0xcd)
+
+	if mem.Fetch(0x0300) != 0xcd {
+		t.Error("Memory is not 0xcd")
+	}
+
+	if mem.LastReadAddr != 0x0300 || mem.LastReadValue != 0xcd {
+		t.Error("Last read is not 0xcd at 0x0300")
+	}
+
+	if mem.LastWriteAddr != 0x0200 || mem.LastWriteValue != 0xab {
+		t.Error("Last write changed after a Fetch")
+	}
+}
+
+func TestPowerOnPattern(t *testing.T) {
+	patterns := map[PowerOnPattern][]uint8{
+		PowerOnZero:        {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		PowerOnFF:          {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		PowerOnAlternating: {0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00},
+		PowerOnFamicom:     {0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0x00},
+	}
+
+	for pattern, expected := range patterns {
+		mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+		mem.Store(0x0000, 0x42)
+		mem.SetPowerOnPattern(pattern)
+		mem.PowerOn()
+
+		for i, value := range expected {
+			if mem.Fetch(uint16(i)) != value {
+				t.Errorf("Pattern %d: memory %#04x is %#02x, not %#02x\n",
+					pattern, i, mem.Fetch(uint16(i)), value)
+			}
+		}
+	}
+}
+
+func TestMappedMemoryWriteProtection(t *testing.T) {
+	mem := NewMappedMemory(NewBasicMemory(DEFAULT_MEMORY_SIZE))
+	cpu := NewM6502(mem, nil)
+
+	mem.Store(0x0100, 0x8d) // STA $c000
+	mem.Store(0x0101, 0x00)
+	mem.Store(0x0102, 0xc0)
+
+	mem.SetPageFlags(0xc0, true, false, true)
+
+	cpu.Registers.A = 0x42
+	cpu.Registers.PC = 0x0100
+
+	if _, err := cpu.Execute(); err != nil {
+		t.Errorf("Error outside of strict mode: %s\n", err)
+	}
+
+	if mem.Fetch(0xc000) != 0x00 {
+		t.Error("Memory 0xc000 was written to")
+	}
+
+	mem.EnableStrict()
+
+	cpu.Registers.PC = 0x0100
+
+	_, err := cpu.Execute()
+
+	if e, ok := err.(WriteProtectionError); !ok {
+		t.Error("Did not receive expected error type WriteProtectionError")
+	} else if e != 0xc000 {
+		t.Error("WriteProtectionError is not 0xc000")
+	}
+
+	if mem.Fetch(0xc000) != 0x00 {
+		t.Error("Memory 0xc000 was written to")
+	}
+}
+
+func TestMappedMemoryExecuteProtection(t *testing.T) {
+	mem := NewMappedMemory(NewBasicMemory(DEFAULT_MEMORY_SIZE))
+	cpu := NewM6502(mem, nil)
+
+	mem.Store(0x0200, 0xe8) // INX
+
+	mem.SetPageFlags(0x02, true, true, false)
+	mem.EnableStrict()
+
+	cpu.Registers.PC = 0x0200
+
+	_, err := cpu.Execute()
+
+	if e, ok := err.(ExecuteProtectionError); !ok {
+		t.Error("Did not receive expected error type ExecuteProtectionError")
+	} else if e != 0x0200 {
+		t.Error("ExecuteProtectionError is not 0x0200")
+	}
+
+	if cpu.Registers.PC != 0x0200 {
+		t.Error("Register PC is not 0x0200")
+	}
+
+	if cpu.Registers.X != 0x00 {
+		t.Error("Register X is not 0x00")
+	}
+
+	if r, w, x := mem.PageFlags(0x02); !r || !w || x {
+		t.Error("Page flags for page 0x02 are not r, w, !x")
+	}
+}
+
+func TestReadString(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	for i, b := range []byte("HELLO\x00WORLD") {
+		mem.Store(0x0400+uint16(i), b)
+	}
+
+	if s := ReadString(mem, 0x0400, 64); s != "HELLO" {
+		t.Errorf("String is %q, not \"HELLO\"\n", s)
+	}
+
+	if s := ReadString(mem, 0x0400, 3); s != "HEL" {
+		t.Errorf("String is %q, not \"HEL\"\n", s)
+	}
+
+	for i, b := range []byte("\x05WORLD!") {
+		mem.Store(0x0500+uint16(i), b)
+	}
+
+	if s := ReadLengthPrefixedString(mem, 0x0500); s != "WORLD" {
+		t.Errorf("String is %q, not \"WORLD\"\n", s)
+	}
+}
+
+func TestFill(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	mem.Fill(0x0400, 0x07ff, 0x20)
+
+	if mem.Fetch(0x03ff) != 0x00 || mem.Fetch(0x0800) != 0x00 {
+		t.Error("Memory outside 0x0400-0x07ff was filled")
+	}
+
+	if mem.Fetch(0x0400) != 0x20 || mem.Fetch(0x07ff) != 0x20 {
+		t.Error("Memory 0x0400 and 0x07ff are not 0x20")
+	}
+
+	mem.Fill(0xff00, 0xffff, 0x42)
+
+	if mem.Fetch(0xffff) != 0x42 || mem.Fetch(0x0000) != 0x00 {
+		t.Error("Fill up to 0xffff did not stop at 0xffff")
+	}
+
+	mem.Fill(0x0800, 0x0400, 0x55)
+
+	if mem.Fetch(0x0400) != 0x20 || mem.Fetch(0x0800) != 0x00 {
+		t.Error("Fill with start > end is not a no-op")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	mem.DisableWrites()
+	mem.Load(0x0600, []byte{0xa9, 0x01, 0x00})
+	mem.EnableWrites()
+
+	if mem.Fetch(0x0600) != 0xa9 || mem.Fetch(0x0601) != 0x01 || mem.Fetch(0x0602) != 0x00 {
+		t.Error("Memory 0x0600-0x0602 is not a9 01 00")
+	}
+
+	mem.Load(0xfffe, []byte{0x11, 0x22, 0x33, 0x44})
+
+	if mem.Fetch(0xfffe) != 0x11 || mem.Fetch(0xffff) != 0x22 {
+		t.Error("Memory 0xfffe-0xffff is not 11 22")
+	}
+
+	if mem.Fetch(0x0000) != 0x33 || mem.Fetch(0x0001) != 0x44 {
+		t.Error("Load did not wrap around to 0x0000")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m65go2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "program.bin")
+
+	if err := ioutil.WriteFile(path, []byte{0xa9, 0x42, 0x8d, 0x00, 0x02}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	if err := mem.LoadFile(path, 0xc000); err != nil {
+		t.Errorf("Error during LoadFile: %s\n", err)
+	}
+
+	for i, b := range []uint8{0xa9, 0x42, 0x8d, 0x00, 0x02} {
+		if mem.Fetch(0xc000+uint16(i)) != b {
+			t.Errorf("Memory %#04x is not %#02x\n", 0xc000+i, b)
+		}
+	}
+
+	if err := mem.LoadFile(path, 0xfffc); err == nil {
+		t.Error("No error loading past 0xffff")
+	}
+
+	if mem.Fetch(0xfffc) != 0x00 {
+		t.Error("Memory changed by a failed LoadFile")
+	}
+
+	if err := mem.LoadFile(filepath.Join(dir, "missing.bin"), 0xc000); err == nil {
+		t.Error("No error loading a missing file")
+	}
+}
+
+func TestMirroredMemory(t *testing.T) {
+	base := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+	mem := NewMirroredMemory(base, 0x0000, 0x0800, 0x1fff)
+
+	mem.Store(0x1801, 0x42)
+
+	if base.Fetch(0x0001) != 0x42 {
+		t.Error("Write to mirror 0x1801 is not visible at 0x0001")
+	}
+
+	base.Store(0x07ff, 0x24)
+
+	for _, address := range []uint16{0x07ff, 0x0fff, 0x17ff, 0x1fff} {
+		if mem.Fetch(address) != 0x24 {
+			t.Errorf("Write to 0x07ff is not visible at %#04x\n", address)
+		}
+	}
+
+	mem.Store(0x2000, 0x55)
+
+	if base.Fetch(0x2000) != 0x55 || base.Fetch(0x0000) != 0x00 {
+		t.Error("Write to 0x2000 was mirrored")
+	}
+}
+
+func TestMappedMemoryHooks(t *testing.T) {
+	base := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+	mem := NewMappedMemory(base)
+
+	var written []uint8
+
+	mem.ReadHook(0x2002, func(address uint16) uint8 {
+		return 0x80
+	})
+
+	mem.WriteHook(0x2006, func(address uint16, value uint8) {
+		written = append(written, value)
+	})
+
+	base.Store(0x2002, 0x11)
+
+	if mem.Fetch(0x2002) != 0x80 {
+		t.Error("Read hook did not intercept 0x2002")
+	}
+
+	mem.Store(0x2006, 0x3f)
+
+	if len(written) != 1 || written[0] != 0x3f {
+		t.Error("Write hook did not intercept 0x2006")
+	}
+
+	if base.Fetch(0x2006) != 0x00 {
+		t.Error("Hooked write reached the base memory")
+	}
+
+	mem.Store(0x2007, 0x42)
+
+	if mem.Fetch(0x2007) != 0x42 || base.Fetch(0x2007) != 0x42 {
+		t.Error("Unhooked address 0x2007 does not behave normally")
+	}
+
+	mem.ReadHook(0x2002, nil)
+
+	if mem.Fetch(0x2002) != 0x11 {
+		t.Error("Read hook was not removed")
+	}
+}
+
+func TestMappedMemoryWatchpoints(t *testing.T) {
+	mem := NewMappedMemory(NewBasicMemory(DEFAULT_MEMORY_SIZE))
+
+	var olds, news, reads []uint8
+
+	mem.WatchWrite(0x0200, func(old, new uint8) {
+		olds = append(olds, old)
+		news = append(news, new)
+	})
+
+	mem.WatchRead(0x0200, func(value uint8) {
+		reads = append(reads, value)
+	})
+
+	mem.Store(0x0200, 0x11)
+	mem.Store(0x0200, 0x22)
+
+	if len(news) != 2 || olds[0] != 0x00 || news[0] != 0x11 || olds[1] != 0x11 || news[1] != 0x22 {
+		t.Error("Write watchpoint did not receive the old and new values")
+	}
+
+	if mem.Fetch(0x0200) != 0x22 {
+		t.Error("Watched write did not reach memory")
+	}
+
+	if len(reads) != 1 || reads[0] != 0x22 {
+		t.Error("Read watchpoint did not receive the value read")
+	}
+
+	mem.Store(0x0201, 0x33)
+	mem.Fetch(0x0201)
+
+	if len(news) != 2 || len(reads) != 1 {
+		t.Error("Watchpoint called for an unwatched address")
+	}
+
+	mem.WatchWrite(0x0200, nil)
+	mem.WatchRead(0x0200, nil)
+
+	mem.Store(0x0200, 0x44)
+	mem.Fetch(0x0200)
+
+	if len(news) != 2 || len(reads) != 1 {
+		t.Error("Watchpoints were not removed")
+	}
+
+	// a write watchpoint must not read a device-backed Memory
+	device := NewMappedMemory(NewBasicMemory(DEFAULT_MEMORY_SIZE))
+	fetches := 0
+
+	device.ReadHook(0x2000, func(address uint16) uint8 {
+		fetches++
+		return 0x00
+	})
+
+	mem = NewMappedMemory(device)
+	mem.WatchWrite(0x2000, func(old, new uint8) {})
+
+	mem.Store(0x2000, 0x55)
+
+	if fetches != 0 {
+		t.Errorf("Watched write read the decorated Memory %d times\n", fetches)
+	}
+}
+
+func TestSetReadOnly(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	mem.Load(0x8000, []byte{0xa9, 0x01})
+	mem.SetReadOnly(0x8000, 0xffff)
+
+	mem.Store(0x8000, 0x42)
+	mem.Store(0xffff, 0x42)
+
+	if mem.Fetch(0x8000) != 0xa9 {
+		t.Error("Write to read only 0x8000 was not dropped")
+	}
+
+	if mem.Fetch(0xffff) != 0x00 {
+		t.Error("Write to read only 0xffff was not dropped")
+	}
+
+	mem.Store(0x7fff, 0x42)
+
+	if mem.Fetch(0x7fff) != 0x42 {
+		t.Error("Write to 0x7fff was dropped")
+	}
+}
+
+func TestDumpRange(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	mem.Load(0x0400, []byte{0x01, 0x02, 0x03})
+
+	data := mem.DumpRange(0x03ff, 0x0402)
+
+	if len(data) != 4 || data[0] != 0x00 || data[1] != 0x01 || data[3] != 0x03 {
+		t.Errorf("DumpRange returned % x, not 00 01 02 03\n", data)
+	}
+
+	data[1] = 0xff
+
+	if mem.Fetch(0x0400) != 0x01 {
+		t.Error("DumpRange did not return a copy")
+	}
+
+	if len(mem.DumpRange(0xfff0, 0xffff)) != 16 {
+		t.Error("DumpRange up to 0xffff did not return 16 bytes")
+	}
+
+	if mem.DumpRange(0x0402, 0x0400) != nil {
+		t.Error("DumpRange with start > end is not nil")
+	}
+}
+
+func TestHexdump(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	mem.Fill(0x0400, 0x0411, 0x20)
+	mem.Store(0x0410, 0xab)
+
+	expected := "0400: 20 20 20 20 20 20 20 20 20 20 20 20 20 20 20 20\n" +
+		"0410: AB 20"
+
+	if dump := mem.Hexdump(0x0400, 0x0411); dump != expected {
+		t.Errorf("Hexdump is %q, not %q\n", dump, expected)
+	}
+}
+
+func TestFetch16Store16(t *testing.T) {
+	mem := NewBasicMemory(DEFAULT_MEMORY_SIZE)
+
+	mem.Store16(0x0200, 0x1234)
+
+	if mem.Fetch(0x0200) != 0x34 || mem.Fetch(0x0201) != 0x12 {
+		t.Error("Store16 did not store 0x34 then 0x12")
+	}
+
+	if mem.Fetch16(0x0200) != 0x1234 {
+		t.Error("Fetch16 is not 0x1234")
+	}
+
+	mem.Store(0xffff, 0xcd)
+	mem.Store(0x0000, 0xab)
+
+	if Fetch16(mem, 0xffff) != 0xabcd {
+		t.Error("Fetch16 at 0xffff did not wrap to 0x0000")
+	}
+}
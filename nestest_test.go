@@ -1,10 +1,11 @@
 package m65go2
 
-func ExampleNesTest() {
+func Example_nesTest() {
 	Setup()
 
 	cpu.EnableDecode()
 	cpu.DisableDecimalMode()
+	cpu.EnableIllegalOpcodes()
 
 	cpu.Registers.P = 0x24
 	cpu.Registers.SP = 0xfd
@@ -0,0 +1,356 @@
+package m65go2
+
+import "fmt"
+
+// Represents the addressing mode used by an instruction to locate its
+// operand.  Accumulator mode instructions have no operand address: the
+// accumulator forms of ASL, LSR, ROL and ROR are executed by AslA,
+// LsrA, RolA and RorA, while their memory forms are executed by Asl,
+// Lsr, Rol and Ror with an address computed by the instruction's
+// addressing mode.
+type AddressingMode uint8
+
+const (
+	Implied         AddressingMode = iota // no operand
+	Accumulator                           // operates on the accumulator
+	Immediate                             // #$nn
+	ZeroPage                              // $nn
+	ZeroPageX                             // $nn,X
+	ZeroPageY                             // $nn,Y
+	Relative                              // branch offset
+	Absolute                              // $nnnn
+	AbsoluteX                             // $nnnn,X
+	AbsoluteY                             // $nnnn,Y
+	Indirect                              // ($nnnn)
+	IndexedIndirect                       // ($nn,X)
+	IndirectIndexed                       // ($nn),Y
+)
+
+var modeNames = [...]string{
+	Implied:         "Implied",
+	Accumulator:     "Accumulator",
+	Immediate:       "Immediate",
+	ZeroPage:        "ZeroPage",
+	ZeroPageX:       "ZeroPageX",
+	ZeroPageY:       "ZeroPageY",
+	Relative:        "Relative",
+	Absolute:        "Absolute",
+	AbsoluteX:       "AbsoluteX",
+	AbsoluteY:       "AbsoluteY",
+	Indirect:        "Indirect",
+	IndexedIndirect: "IndexedIndirect",
+	IndirectIndexed: "IndirectIndexed",
+}
+
+// Returns the name of the addressing mode.
+func (mode AddressingMode) String() string {
+	if int(mode) < len(modeNames) {
+		return modeNames[mode]
+	}
+
+	return fmt.Sprintf("AddressingMode(%d)", uint8(mode))
+}
+
+// Returns the number of operand bytes following the opcode of an
+// instruction using the addressing mode.
+func (mode AddressingMode) OperandSize() uint8 {
+	switch mode {
+	case Implied, Accumulator:
+		return 0
+	case Absolute, AbsoluteX, AbsoluteY, Indirect:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Describes the instruction for an opcode independently of any CPU or
+// InstructionTable.
+type opcodeInfo struct {
+	mnemonic  string         // empty if the opcode is undefined
+	mode      AddressingMode // addressing mode of the operand
+	cycles    uint8          // base number of cycles
+	pageCross bool           // takes an extra cycle when crossing a page
+}
+
+// Describes every opcode registered by InitInstructions, with cycle
+// counts matching those returned by Execute.  Unofficial opcodes have
+// their mnemonic prefixed with '*'.
+var opcodes = [256]opcodeInfo{
+	0x00: {"BRK", Implied, 7, false},
+	0x01: {"ORA", IndexedIndirect, 6, false},
+	0x03: {"*SLO", IndexedIndirect, 8, false},
+	0x04: {"*NOP", ZeroPage, 3, false},
+	0x05: {"ORA", ZeroPage, 3, false},
+	0x06: {"ASL", ZeroPage, 5, false},
+	0x07: {"*SLO", ZeroPage, 5, false},
+	0x08: {"PHP", Implied, 3, false},
+	0x09: {"ORA", Immediate, 2, false},
+	0x0a: {"ASL", Accumulator, 2, false},
+	0x0c: {"*NOP", Absolute, 4, false},
+	0x0d: {"ORA", Absolute, 4, false},
+	0x0e: {"ASL", Absolute, 6, false},
+	0x0f: {"*SLO", Absolute, 6, false},
+	0x10: {"BPL", Relative, 2, false},
+	0x11: {"ORA", IndirectIndexed, 5, true},
+	0x13: {"*SLO", IndirectIndexed, 8, false},
+	0x14: {"*NOP", ZeroPageX, 4, false},
+	0x15: {"ORA", ZeroPageX, 4, false},
+	0x16: {"ASL", ZeroPageX, 6, false},
+	0x17: {"*SLO", ZeroPageX, 6, false},
+	0x18: {"CLC", Implied, 2, false},
+	0x19: {"ORA", AbsoluteY, 4, true},
+	0x1a: {"*NOP", Implied, 2, false},
+	0x1b: {"*SLO", AbsoluteY, 7, false},
+	0x1c: {"*NOP", AbsoluteX, 4, true},
+	0x1d: {"ORA", AbsoluteX, 4, true},
+	0x1e: {"ASL", AbsoluteX, 7, false},
+	0x1f: {"*SLO", AbsoluteX, 7, false},
+	0x20: {"JSR", Absolute, 6, false},
+	0x21: {"AND", IndexedIndirect, 6, false},
+	0x23: {"*RLA", IndexedIndirect, 8, false},
+	0x24: {"BIT", ZeroPage, 3, false},
+	0x25: {"AND", ZeroPage, 3, false},
+	0x26: {"ROL", ZeroPage, 5, false},
+	0x27: {"*RLA", ZeroPage, 5, false},
+	0x28: {"PLP", Implied, 4, false},
+	0x29: {"AND", Immediate, 2, false},
+	0x2a: {"ROL", Accumulator, 2, false},
+	0x2c: {"BIT", Absolute, 4, false},
+	0x2d: {"AND", Absolute, 4, false},
+	0x2e: {"ROL", Absolute, 6, false},
+	0x2f: {"*RLA", Absolute, 6, false},
+	0x30: {"BMI", Relative, 2, false},
+	0x31: {"AND", IndirectIndexed, 5, true},
+	0x33: {"*RLA", IndirectIndexed, 8, false},
+	0x34: {"*NOP", ZeroPageX, 4, false},
+	0x35: {"AND", ZeroPageX, 4, false},
+	0x36: {"ROL", ZeroPageX, 6, false},
+	0x37: {"*RLA", ZeroPageX, 6, false},
+	0x38: {"SEC", Implied, 2, false},
+	0x39: {"AND", AbsoluteY, 4, true},
+	0x3a: {"*NOP", Implied, 2, false},
+	0x3b: {"*RLA", AbsoluteY, 7, false},
+	0x3c: {"*NOP", AbsoluteX, 4, true},
+	0x3d: {"AND", AbsoluteX, 4, true},
+	0x3e: {"ROL", AbsoluteX, 7, false},
+	0x3f: {"*RLA", AbsoluteX, 7, false},
+	0x40: {"RTI", Implied, 6, false},
+	0x41: {"EOR", IndexedIndirect, 6, false},
+	0x43: {"*SRE", IndexedIndirect, 8, false},
+	0x44: {"*NOP", ZeroPage, 3, false},
+	0x45: {"EOR", ZeroPage, 3, false},
+	0x46: {"LSR", ZeroPage, 5, false},
+	0x47: {"*SRE", ZeroPage, 5, false},
+	0x48: {"PHA", Implied, 3, false},
+	0x49: {"EOR", Immediate, 2, false},
+	0x4a: {"LSR", Accumulator, 2, false},
+	0x4c: {"JMP", Absolute, 3, false},
+	0x4d: {"EOR", Absolute, 4, false},
+	0x4e: {"LSR", Absolute, 6, false},
+	0x4f: {"*SRE", Absolute, 6, false},
+	0x50: {"BVC", Relative, 2, false},
+	0x51: {"EOR", IndirectIndexed, 5, true},
+	0x53: {"*SRE", IndirectIndexed, 8, false},
+	0x54: {"*NOP", ZeroPageX, 4, false},
+	0x55: {"EOR", ZeroPageX, 4, false},
+	0x56: {"LSR", ZeroPageX, 6, false},
+	0x57: {"*SRE", ZeroPageX, 6, false},
+	0x58: {"CLI", Implied, 2, false},
+	0x59: {"EOR", AbsoluteY, 4, true},
+	0x5a: {"*NOP", Implied, 2, false},
+	0x5b: {"*SRE", AbsoluteY, 7, false},
+	0x5c: {"*NOP", AbsoluteX, 4, true},
+	0x5d: {"EOR", AbsoluteX, 4, true},
+	0x5e: {"LSR", AbsoluteX, 7, false},
+	0x5f: {"*SRE", AbsoluteX, 7, false},
+	0x60: {"RTS", Implied, 6, false},
+	0x61: {"ADC", IndexedIndirect, 6, false},
+	0x63: {"*RRA", IndexedIndirect, 8, false},
+	0x64: {"*NOP", ZeroPage, 3, false},
+	0x65: {"ADC", ZeroPage, 3, false},
+	0x66: {"ROR", ZeroPage, 5, false},
+	0x67: {"*RRA", ZeroPage, 5, false},
+	0x68: {"PLA", Implied, 4, false},
+	0x69: {"ADC", Immediate, 2, false},
+	0x6a: {"ROR", Accumulator, 2, false},
+	0x6c: {"JMP", Indirect, 5, false},
+	0x6d: {"ADC", Absolute, 4, false},
+	0x6e: {"ROR", Absolute, 6, false},
+	0x6f: {"*RRA", Absolute, 6, false},
+	0x70: {"BVS", Relative, 2, false},
+	0x71: {"ADC", IndirectIndexed, 5, true},
+	0x73: {"*RRA", IndirectIndexed, 8, false},
+	0x74: {"*NOP", ZeroPageX, 4, false},
+	0x75: {"ADC", ZeroPageX, 4, false},
+	0x76: {"ROR", ZeroPageX, 6, false},
+	0x77: {"*RRA", ZeroPageX, 6, false},
+	0x78: {"SEI", Implied, 2, false},
+	0x79: {"ADC", AbsoluteY, 4, true},
+	0x7a: {"*NOP", Implied, 2, false},
+	0x7b: {"*RRA", AbsoluteY, 7, false},
+	0x7c: {"*NOP", AbsoluteX, 4, true},
+	0x7d: {"ADC", AbsoluteX, 4, true},
+	0x7e: {"ROR", AbsoluteX, 7, false},
+	0x7f: {"*RRA", AbsoluteX, 7, false},
+	0x80: {"*NOP", Immediate, 2, false},
+	0x81: {"STA", IndexedIndirect, 6, false},
+	0x83: {"*SAX", IndexedIndirect, 6, false},
+	0x84: {"STY", ZeroPage, 3, false},
+	0x85: {"STA", ZeroPage, 3, false},
+	0x86: {"STX", ZeroPage, 3, false},
+	0x87: {"*SAX", ZeroPage, 3, false},
+	0x88: {"DEY", Implied, 2, false},
+	0x8a: {"TXA", Implied, 2, false},
+	0x8c: {"STY", Absolute, 4, false},
+	0x8d: {"STA", Absolute, 4, false},
+	0x8e: {"STX", Absolute, 4, false},
+	0x8f: {"*SAX", Absolute, 4, false},
+	0x90: {"BCC", Relative, 2, false},
+	0x91: {"STA", IndirectIndexed, 6, false},
+	0x94: {"STY", ZeroPageX, 4, false},
+	0x95: {"STA", ZeroPageX, 4, false},
+	0x96: {"STX", ZeroPageY, 4, false},
+	0x97: {"*SAX", ZeroPageY, 4, false},
+	0x98: {"TYA", Implied, 2, false},
+	0x99: {"STA", AbsoluteY, 5, false},
+	0x9a: {"TXS", Implied, 2, false},
+	0x9d: {"STA", AbsoluteX, 5, false},
+	0xa0: {"LDY", Immediate, 2, false},
+	0xa1: {"LDA", IndexedIndirect, 6, false},
+	0xa2: {"LDX", Immediate, 2, false},
+	0xa3: {"*LAX", IndexedIndirect, 6, false},
+	0xa4: {"LDY", ZeroPage, 3, false},
+	0xa5: {"LDA", ZeroPage, 3, false},
+	0xa6: {"LDX", ZeroPage, 3, false},
+	0xa7: {"*LAX", ZeroPage, 3, false},
+	0xa8: {"TAY", Implied, 2, false},
+	0xa9: {"LDA", Immediate, 2, false},
+	0xaa: {"TAX", Implied, 2, false},
+	0xac: {"LDY", Absolute, 4, false},
+	0xad: {"LDA", Absolute, 4, false},
+	0xae: {"LDX", Absolute, 4, false},
+	0xaf: {"*LAX", Absolute, 4, false},
+	0xb0: {"BCS", Relative, 2, false},
+	0xb1: {"LDA", IndirectIndexed, 5, true},
+	0xb3: {"*LAX", IndirectIndexed, 5, true},
+	0xb4: {"LDY", ZeroPageX, 4, false},
+	0xb5: {"LDA", ZeroPageX, 4, false},
+	0xb6: {"LDX", ZeroPageY, 4, false},
+	0xb7: {"*LAX", ZeroPageY, 4, false},
+	0xb8: {"CLV", Implied, 2, false},
+	0xb9: {"LDA", AbsoluteY, 4, true},
+	0xba: {"TSX", Implied, 2, false},
+	0xbc: {"LDY", AbsoluteX, 4, true},
+	0xbd: {"LDA", AbsoluteX, 4, true},
+	0xbe: {"LDX", AbsoluteY, 4, true},
+	0xbf: {"*LAX", AbsoluteY, 4, true},
+	0xc0: {"CPY", Immediate, 2, false},
+	0xc1: {"CMP", IndexedIndirect, 6, false},
+	0xc3: {"*DCP", IndexedIndirect, 8, false},
+	0xc4: {"CPY", ZeroPage, 3, false},
+	0xc5: {"CMP", ZeroPage, 3, false},
+	0xc6: {"DEC", ZeroPage, 5, false},
+	0xc7: {"*DCP", ZeroPage, 5, false},
+	0xc8: {"INY", Implied, 2, false},
+	0xc9: {"CMP", Immediate, 2, false},
+	0xca: {"DEX", Implied, 2, false},
+	0xcc: {"CPY", Absolute, 4, false},
+	0xcd: {"CMP", Absolute, 4, false},
+	0xce: {"DEC", Absolute, 6, false},
+	0xcf: {"*DCP", Absolute, 6, false},
+	0xd0: {"BNE", Relative, 2, false},
+	0xd1: {"CMP", IndirectIndexed, 5, true},
+	0xd3: {"*DCP", IndirectIndexed, 8, false},
+	0xd4: {"*NOP", ZeroPageX, 4, false},
+	0xd5: {"CMP", ZeroPageX, 4, false},
+	0xd6: {"DEC", ZeroPageX, 6, false},
+	0xd7: {"*DCP", ZeroPageX, 6, false},
+	0xd8: {"CLD", Implied, 2, false},
+	0xd9: {"CMP", AbsoluteY, 4, true},
+	0xda: {"*NOP", Implied, 2, false},
+	0xdb: {"*DCP", AbsoluteY, 7, false},
+	0xdc: {"*NOP", AbsoluteX, 4, true},
+	0xdd: {"CMP", AbsoluteX, 4, true},
+	0xde: {"DEC", AbsoluteX, 7, false},
+	0xdf: {"*DCP", AbsoluteX, 7, false},
+	0xe0: {"CPX", Immediate, 2, false},
+	0xe1: {"SBC", IndexedIndirect, 6, false},
+	0xe3: {"*ISB", IndexedIndirect, 8, false},
+	0xe4: {"CPX", ZeroPage, 3, false},
+	0xe5: {"SBC", ZeroPage, 3, false},
+	0xe6: {"INC", ZeroPage, 5, false},
+	0xe7: {"*ISB", ZeroPage, 5, false},
+	0xe8: {"INX", Implied, 2, false},
+	0xe9: {"SBC", Immediate, 2, false},
+	0xea: {"NOP", Implied, 2, false},
+	0xeb: {"*SBC", Immediate, 2, false},
+	0xec: {"CPX", Absolute, 4, false},
+	0xed: {"SBC", Absolute, 4, false},
+	0xee: {"INC", Absolute, 6, false},
+	0xef: {"*ISB", Absolute, 6, false},
+	0xf0: {"BEQ", Relative, 2, false},
+	0xf1: {"SBC", IndirectIndexed, 5, true},
+	0xf3: {"*ISB", IndirectIndexed, 8, false},
+	0xf4: {"*NOP", ZeroPageX, 4, false},
+	0xf5: {"SBC", ZeroPageX, 4, false},
+	0xf6: {"INC", ZeroPageX, 6, false},
+	0xf7: {"*ISB", ZeroPageX, 6, false},
+	0xf8: {"SED", Implied, 2, false},
+	0xf9: {"SBC", AbsoluteY, 4, true},
+	0xfa: {"*NOP", Implied, 2, false},
+	0xfb: {"*ISB", AbsoluteY, 7, false},
+	0xfc: {"*NOP", AbsoluteX, 4, true},
+	0xfd: {"SBC", AbsoluteX, 4, true},
+	0xfe: {"INC", AbsoluteX, 7, false},
+	0xff: {"*ISB", AbsoluteX, 7, false},
+}
+
+// Describes the opcodes the 65C02 adds or redefines, registered by
+// InitCMOSInstructions.
+var cmosOpcodes = [256]opcodeInfo{
+	0x5a: {"PHY", Implied, 3, false},
+	0x64: {"STZ", ZeroPage, 3, false},
+	0x6c: {"JMP", Indirect, 6, false},
+	0x74: {"STZ", ZeroPageX, 4, false},
+	0x7a: {"PLY", Implied, 4, false},
+	0x80: {"BRA", Relative, 2, false},
+	0x9c: {"STZ", Absolute, 4, false},
+	0x9e: {"STZ", AbsoluteX, 5, false},
+	0xda: {"PHX", Implied, 3, false},
+	0xfa: {"PLX", Implied, 4, false},
+}
+
+// Returns true iff the opcode is one of the 151 documented 6502
+// instructions.  Unofficial and undefined opcodes are not legal.
+func (op OpCode) IsLegal() bool {
+	mnemonic := opcodes[op].mnemonic
+	return mnemonic != "" && mnemonic[0] != '*'
+}
+
+// Returns true iff the opcode is one of the NMOS 6502's KIL (also
+// known as JAM) opcodes, which lock up the processor until it is
+// reset.
+func (op OpCode) IsJam() bool {
+	return op&0x0f == 0x02 && op != 0x82 && op != 0xa2 && op != 0xc2 && op != 0xe2
+}
+
+// Returns true iff the opcode reads a byte of memory, modifies it and
+// writes it back, i.e. the memory forms of ASL, LSR, ROL, ROR, INC and
+// DEC along with the unofficial instructions built on them (SLO, RLA,
+// SRE, RRA, DCP and ISB).
+func (op OpCode) IsReadModifyWrite() bool {
+	info := opcodes[op]
+
+	if info.mode == Accumulator {
+		return false
+	}
+
+	switch info.mnemonic {
+	case "ASL", "LSR", "ROL", "ROR", "INC", "DEC",
+		"*SLO", "*RLA", "*SRE", "*RRA", "*DCP", "*ISB":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,161 @@
+package m65go2
+
+import "testing"
+
+func TestIsLegal(t *testing.T) {
+	if !OpCode(0xa9).IsLegal() {
+		t.Error("Opcode 0xa9 is not legal")
+	}
+
+	if OpCode(0x02).IsLegal() {
+		t.Error("Opcode 0x02 is legal")
+	}
+
+	if OpCode(0xa7).IsLegal() {
+		t.Error("Unofficial opcode 0xa7 is legal")
+	}
+
+	legal := 0
+
+	for op := 0; op < 256; op++ {
+		if OpCode(op).IsLegal() {
+			legal++
+		}
+	}
+
+	if legal != 151 {
+		t.Errorf("%d opcodes are legal, not 151\n", legal)
+	}
+}
+
+func TestIsJam(t *testing.T) {
+	if !OpCode(0x02).IsJam() || !OpCode(0xf2).IsJam() {
+		t.Error("Opcodes 0x02 and 0xf2 are not jams")
+	}
+
+	if OpCode(0xa2).IsJam() || OpCode(0x82).IsJam() {
+		t.Error("Opcodes 0xa2 and 0x82 are jams")
+	}
+
+	jams := 0
+
+	for op := 0; op < 256; op++ {
+		if OpCode(op).IsJam() {
+			jams++
+		}
+	}
+
+	if jams != 12 {
+		t.Errorf("%d opcodes are jams, not 12\n", jams)
+	}
+}
+
+func TestIsReadModifyWrite(t *testing.T) {
+	for _, op := range []OpCode{0x06, 0xee, 0x7e, 0xc7} {
+		if !op.IsReadModifyWrite() {
+			t.Errorf("Opcode %#02x is not read-modify-write\n", op)
+		}
+	}
+
+	for _, op := range []OpCode{0x0a, 0xa9, 0x85, 0x02} {
+		if op.IsReadModifyWrite() {
+			t.Errorf("Opcode %#02x is read-modify-write\n", op)
+		}
+	}
+}
+
+func TestAddressingModes(t *testing.T) {
+	Setup()
+
+	counts := make(map[AddressingMode]int)
+
+	for op := 0; op < 256; op++ {
+		if inst, ok := cpu.Instructions.Lookup(OpCode(op)); ok && OpCode(op).IsLegal() {
+			counts[inst.Mode()]++
+		}
+	}
+
+	for mode, count := range map[AddressingMode]int{
+		Implied:         25,
+		Accumulator:     4,
+		Immediate:       11,
+		ZeroPage:        21,
+		ZeroPageX:       16,
+		ZeroPageY:       2,
+		Relative:        8,
+		Absolute:        23,
+		AbsoluteX:       15,
+		AbsoluteY:       9,
+		Indirect:        1,
+		IndexedIndirect: 8,
+		IndirectIndexed: 8,
+	} {
+		if counts[mode] != count {
+			t.Errorf("%s has %d legal opcodes, not %d\n", mode, counts[mode], count)
+		}
+	}
+
+	for opcode, mode := range map[OpCode]AddressingMode{
+		0x4a: Accumulator,
+		0x46: ZeroPage,
+		0xb6: ZeroPageY,
+		0x6c: Indirect,
+		0xa1: IndexedIndirect,
+		0x30: Relative,
+		0xea: Implied,
+	} {
+		if inst, _ := cpu.Instructions.Lookup(opcode); inst.Mode() != mode {
+			t.Errorf("Opcode %#02x has mode %s, not %s\n", opcode, inst.Mode(), mode)
+		}
+	}
+
+	if IndirectIndexed.String() != "IndirectIndexed" {
+		t.Error("IndirectIndexed does not print as IndirectIndexed")
+	}
+
+	Teardown()
+}
+
+func TestAccumulatorMode(t *testing.T) {
+	Setup()
+
+	for mnemonic, ops := range map[string][2]OpCode{
+		"ASL": {0x0a, 0x06},
+		"LSR": {0x4a, 0x46},
+		"ROL": {0x2a, 0x26},
+		"ROR": {0x6a, 0x66},
+	} {
+		accumulator, _ := cpu.Instructions.Lookup(ops[0])
+		zeroPage, _ := cpu.Instructions.Lookup(ops[1])
+
+		if accumulator.Mode() != Accumulator || accumulator.Size() != 1 {
+			t.Errorf("%s A is not tagged as a one byte Accumulator instruction\n", mnemonic)
+		}
+
+		if zeroPage.Mode() != ZeroPage || zeroPage.Size() != 2 {
+			t.Errorf("%s $nn is not tagged as a two byte ZeroPage instruction\n", mnemonic)
+		}
+
+		if text := DisassembleBytes([]byte{uint8(ops[0])}, 0x0200)[0]; text != "0200: "+mnemonic+" A" {
+			t.Errorf("%s A disassembles as %q\n", mnemonic, text)
+		}
+
+		if text := DisassembleBytes([]byte{uint8(ops[1]), 0x10}, 0x0200)[0]; text != "0200: "+mnemonic+" $10" {
+			t.Errorf("%s $nn disassembles as %q\n", mnemonic, text)
+		}
+	}
+
+	modes := 0
+
+	for op := 0; op < 256; op++ {
+		if inst, ok := cpu.Instructions.Lookup(OpCode(op)); ok && inst.Mode() == Accumulator {
+			modes++
+		}
+	}
+
+	if modes != 4 {
+		t.Errorf("%d instructions use Accumulator mode, not 4\n", modes)
+	}
+
+	Teardown()
+}